@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+
+	"github.com/taigrr/mg/parse"
+)
+
+// credentials picks the auth method for remotes. It is replaced by GetConfig
+// with one using the per-host settings from the config.
+var credentials = newAuthenticator(nil, nil)
+
+// authenticator picks credentials for remotes based on their host. Results
+// are cached per host, so passphrases and credential helpers are only asked
+// once per run no matter how many repos share a host. SSH host keys are
+// checked according to knownHosts.
+type authenticator struct {
+	hosts      map[string]parse.HostAuth
+	knownHosts *parse.KnownHosts
+	mutex      sync.Mutex
+	cache      map[string]cachedAuth
+	netrc      *parse.Netrc
+	hostKeys   *hostKeyChecker
+}
+
+// authError is returned when credentials for a host cannot be loaded.
+type authError struct {
+	Host string
+	err  error
+}
+
+func (e *authError) Error() string {
+	return fmt.Sprintf("authenticating to %s: %s", e.Host, e.err)
+}
+
+func (e *authError) Unwrap() error { return e.err }
+
+type cachedAuth struct {
+	auth transport.AuthMethod
+	err  error
+}
+
+func newAuthenticator(hosts map[string]parse.HostAuth, knownHosts *parse.KnownHosts) *authenticator {
+	return &authenticator{hosts: hosts, knownHosts: knownHosts, cache: map[string]cachedAuth{}}
+}
+
+// remoteAuth returns the auth method for the first URL of the named remote.
+func remoteAuth(r *git.Repository, name string) (transport.AuthMethod, error) {
+	remote, err := r.Remote(name)
+	if err != nil {
+		return nil, err
+	}
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	return credentials.forURL(urls[0])
+}
+
+// forURL returns the auth method for url. A nil method means go-git's
+// defaults are used, e.g. for local paths or URLs with embedded credentials.
+func (a *authenticator) forURL(url string) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+	if ep.Protocol != "ssh" && ep.Protocol != "http" && ep.Protocol != "https" {
+		return nil, nil
+	}
+	if ep.Password != "" {
+		return nil, nil
+	}
+	settings := a.hosts[ep.Host]
+	user := settings.User
+	if user == "" {
+		user = ep.User
+	}
+	key := ep.Protocol + "://" + user + "@" + ep.Host
+
+	// hold the lock while prompting so parallel jobs ask only once
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if cached, ok := a.cache[key]; ok {
+		return cached.auth, cached.err
+	}
+	var auth transport.AuthMethod
+	if ep.Protocol == "ssh" {
+		auth, err = sshAuth(user, settings)
+		if err == nil {
+			err = a.checkHostKeys(auth, ep)
+		}
+	} else {
+		auth, err = a.httpAuth(ep, user, settings)
+	}
+	if err != nil {
+		err = &authError{Host: ep.Host, err: err}
+	}
+	a.cache[key] = cachedAuth{auth: auth, err: err}
+	return auth, err
+}
+
+// checkHostKeys makes an SSH auth method for ep verify host keys with the
+// known hosts policy. The known_hosts files are only read once SSH is first
+// used.
+func (a *authenticator) checkHostKeys(auth transport.AuthMethod, ep *transport.Endpoint) error {
+	if auth == nil {
+		return nil
+	}
+	if a.hostKeys == nil {
+		checker, err := newHostKeyChecker(hostKeyPolicy(a.knownHosts))
+		if err != nil {
+			return err
+		}
+		a.hostKeys = checker
+	}
+	// go-git only picks the algorithms from known_hosts without a callback
+	algorithms := a.hostKeys.hostKeyAlgorithms(ep.Host, ep.Port)
+	switch m := auth.(type) {
+	case *gitssh.PublicKeys:
+		m.HostKeyCallback = a.hostKeys.check
+		m.HostKeyAlgorithms = algorithms
+	case *gitssh.PublicKeysCallback:
+		m.HostKeyCallback = a.hostKeys.check
+		m.HostKeyAlgorithms = algorithms
+	}
+	return nil
+}
+
+// sshAuth uses the configured key file, then ssh-agent, then the first of
+// the default key files in ~/.ssh that exists.
+func sshAuth(user string, settings parse.HostAuth) (transport.AuthMethod, error) {
+	if user == "" {
+		user = "git"
+	}
+	if settings.SSHKey != "" {
+		return loadSSHKey(user, expandHome(settings.SSHKey))
+	}
+	if os.Getenv("SSH_AUTH_SOCK") != "" {
+		return gitssh.NewSSHAgentAuth(user)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil
+	}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err == nil {
+			return loadSSHKey(user, path)
+		}
+	}
+	return nil, nil
+}
+
+// loadSSHKey reads a private key file, prompting for its passphrase on the
+// terminal if it is encrypted.
+func loadSSHKey(user, path string) (transport.AuthMethod, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := parseSSHPrivateKey(path, b)
+	if err != nil {
+		return nil, err
+	}
+	return &gitssh.PublicKeys{User: user, Signer: signer}, nil
+}
+
+// httpAuth uses the token from the configured environment variable, then the
+// configured credential helper, then ~/.netrc, then git's own
+// credential.helper. Without any of them the request is anonymous.
+func (a *authenticator) httpAuth(ep *transport.Endpoint, user string, settings parse.HostAuth) (transport.AuthMethod, error) {
+	if settings.TokenEnv != "" {
+		if token := os.Getenv(settings.TokenEnv); token != "" {
+			if user == "" {
+				user = "git"
+			}
+			return &githttp.BasicAuth{Username: user, Password: token}, nil
+		}
+	}
+	if settings.CredentialHelper != "" {
+		return credentialHelperAuth(settings.CredentialHelper, ep, user)
+	}
+	if a.netrc == nil {
+		n, err := parse.LoadNetrc()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		a.netrc = &n
+	}
+	if m, ok := a.netrc.Find(ep.Host); ok && m.Password != "" {
+		if user == "" {
+			user = m.Login
+		}
+		return &githttp.BasicAuth{Username: user, Password: m.Password}, nil
+	}
+	if cfg, err := config.LoadConfig(config.GlobalScope); err == nil {
+		if cfg.Raw.Section("credential").Option("helper") != "" {
+			return credentialHelperAuth("", ep, user)
+		}
+	}
+	return nil, nil
+}
+
+// credentialHelperAuth asks git credential fill for a username and
+// password, so helpers are found the way git finds them, including helpers
+// such as store and cache that only live in git's exec path. A non-empty
+// helper replaces the helpers configured in git. Terminal prompts are
+// disabled, and when the helpers fail or have no credentials the request is
+// anonymous, as it would be without a helper.
+func credentialHelperAuth(helper string, ep *transport.Endpoint, user string) (transport.AuthMethod, error) {
+	host := ep.Host
+	if ep.Port != 0 && ep.Port != 80 && ep.Port != 443 {
+		host += ":" + strconv.Itoa(ep.Port)
+	}
+	input := fmt.Sprintf("protocol=%s\nhost=%s\n", ep.Protocol, host)
+	if user != "" {
+		input += "username=" + user + "\n"
+	}
+	var args []string
+	if helper != "" {
+		// an empty helper clears the list of helpers from git's config
+		args = append(args, "-c", "credential.helper=", "-c", "credential.helper="+helper)
+	}
+	args = append(args, "credential", "fill")
+	c := exec.Command("git", args...)
+	c.Stdin = strings.NewReader(input + "\n")
+	c.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr strings.Builder
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		log.Printf("no credentials from git credential fill for %s, continuing without: %s\n", host, msg)
+		return nil, nil
+	}
+	auth := &githttp.BasicAuth{Username: user}
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "username":
+			auth.Username = value
+		case "password":
+			auth.Password = value
+		}
+	}
+	if auth.Password == "" {
+		return nil, nil
+	}
+	return auth, nil
+}
+
+// expandHome expands environment variables and a leading ~ in path.
+func expandHome(path string) string {
+	path = os.ExpandEnv(path)
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
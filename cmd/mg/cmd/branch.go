@@ -0,0 +1,396 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
+)
+
+var (
+	branchForce  bool
+	branchDelete bool
+	branchCmd    = &cobra.Command{
+		Use:   "branch",
+		Short: "manage branches across all repos",
+	}
+	branchListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "show which repos have which local and remote branches",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			var (
+				mutex    sync.Mutex
+				branches = map[string]map[string]string{}
+			)
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				found, err := repoBranches(r)
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				mutex.Lock()
+				for name, where := range found {
+					if branches[name] == nil {
+						branches[name] = map[string]string{}
+					}
+					branches[name][repo.Path] = where
+				}
+				mutex.Unlock()
+				return repoResult{}
+			})
+
+			names := make([]string, 0, len(branches))
+			for name := range branches {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			header := []string{"BRANCH"}
+			for _, repo := range conf.Repos {
+				header = append(header, filepath.Base(repo.Path))
+			}
+			fmt.Fprintln(tw, strings.Join(header, "\t"))
+			for _, name := range names {
+				row := []string{name}
+				for _, repo := range conf.Repos {
+					where := branches[name][repo.Path]
+					if where == "" {
+						where = "-"
+					}
+					row = append(row, where)
+				}
+				fmt.Fprintln(tw, strings.Join(row, "\t"))
+			}
+			tw.Flush()
+			fmt.Println()
+			fmt.Println("L = local branch, R = remote branch")
+			for _, res := range results {
+				if res.Err != nil {
+					log.Printf("error reading %s: %s\n", res.Repo, res.Err)
+				}
+			}
+			return resultsError(results, "read")
+		},
+	}
+	branchCreateCmd = &cobra.Command{
+		Use:   "create <name>",
+		Short: "create a branch at HEAD in all repos",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			name := plumbing.NewBranchReferenceName(args[0])
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if _, err := r.Reference(name, false); err == nil {
+					repoPrintf(repo.Path, "repo %s: branch %s already exists\n", repo.Path, args[0])
+					return repoResult{Skipped: true}
+				}
+				head, err := r.Head()
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if dryRun {
+					repoPrintf(repo.Path, "repo %s: would create branch %s at %s\n", repo.Path, args[0], head.Hash().String()[:7])
+					return repoResult{}
+				}
+				err = r.Storer.SetReference(plumbing.NewHashReference(name, head.Hash()))
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				repoPrintf(repo.Path, "created branch %s in %s\n", args[0], repo.Path)
+				return repoResult{}
+			})
+			return printSummary(results, dryRunSummary(summary{Verb: "create branch in", Past: "created branch in", Skipped: "already had the branch"}))
+		},
+	}
+	branchDeleteCmd = &cobra.Command{
+		Use:   "delete <name>",
+		Short: "delete a local branch in all repos once it is merged",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				ref, err := r.Reference(plumbing.NewBranchReferenceName(args[0]), false)
+				if errors.Is(err, plumbing.ErrReferenceNotFound) {
+					repoPrintf(repo.Path, "repo %s: no branch %s\n", repo.Path, args[0])
+					return repoResult{Skipped: true}
+				} else if err != nil {
+					return repoResult{Err: err}
+				}
+				if !branchForce {
+					merged, err := isMerged(r, repo, ref)
+					if err != nil {
+						return repoResult{Err: err}
+					}
+					if !merged {
+						return repoResult{Err: errNotMerged}
+					}
+				}
+				if dryRun {
+					repoPrintf(repo.Path, "repo %s: would delete branch %s at %s\n", repo.Path, args[0], ref.Hash().String()[:7])
+					return repoResult{}
+				}
+				if err := deleteBranch(r, ref.Name()); err != nil {
+					return repoResult{Err: err}
+				}
+				repoPrintf(repo.Path, "deleted branch %s in %s\n", args[0], repo.Path)
+				return repoResult{}
+			})
+			return printSummary(results, dryRunSummary(summary{Verb: "delete branch in", Past: "deleted branch in", Skipped: "did not have the branch"}))
+		},
+	}
+	branchMergedCmd = &cobra.Command{
+		Use:   "merged",
+		Short: "list local branches already merged into the default branch",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			var (
+				mutex  sync.Mutex
+				merged = map[string][]string{}
+			)
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				names, err := mergedBranches(r, repo)
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if branchDelete && !dryRun {
+					for _, name := range names {
+						if err := deleteBranch(r, plumbing.NewBranchReferenceName(name)); err != nil {
+							return repoResult{Err: err}
+						}
+					}
+				}
+				mutex.Lock()
+				merged[repo.Path] = names
+				mutex.Unlock()
+				return repoResult{}
+			})
+
+			total := 0
+			for _, repo := range conf.Repos {
+				names := merged[repo.Path]
+				if len(names) == 0 {
+					continue
+				}
+				total += len(names)
+				fmt.Printf("%s:\n", repo.Path)
+				for _, name := range names {
+					fmt.Printf("  %s\n", name)
+				}
+				fmt.Println()
+			}
+			failed := 0
+			for _, res := range results {
+				if res.Err != nil {
+					failed++
+					log.Printf("error reading %s: %s\n", res.Repo, res.Err)
+				}
+			}
+			switch {
+			case branchDelete && dryRun:
+				fmt.Printf("would delete %d merged branches\n", total)
+			case branchDelete:
+				fmt.Printf("deleted %d merged branches\n", total)
+			default:
+				fmt.Printf("%d merged branches\n", total)
+			}
+			if failed > 0 {
+				fmt.Printf("failed to read %d/%d repos\n", failed, len(conf.Repos))
+			}
+			return resultsError(results, "read")
+		},
+	}
+)
+
+var errNotMerged = errors.New("branch is not merged into the default branch (use --force to delete anyway)")
+
+// repoBranches returns every branch name in r, marked with L if it exists
+// locally and R if it exists on any remote.
+func repoBranches(r *git.Repository) (map[string]string, error) {
+	refs, err := r.References()
+	if err != nil {
+		return nil, err
+	}
+	local, remote := map[string]bool{}, map[string]bool{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		switch {
+		case ref.Name().IsBranch():
+			local[ref.Name().Short()] = true
+		case ref.Name().IsRemote():
+			// strip the remote name from origin/branch
+			_, name, ok := strings.Cut(ref.Name().Short(), "/")
+			if ok && name != "HEAD" {
+				remote[name] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]string{}
+	for name := range local {
+		found[name] = "L"
+	}
+	for name := range remote {
+		found[name] += "R"
+	}
+	return found, nil
+}
+
+// defaultBranch returns the branch other branches get merged into. This is
+// the pinned branch if there is one, then whatever origin/HEAD points to,
+// then main or master.
+func defaultBranch(r *git.Repository, repo parse.Repo) (plumbing.ReferenceName, error) {
+	if repo.Branch != "" {
+		return plumbing.NewBranchReferenceName(repo.Branch), nil
+	}
+	originHead := plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName)
+	if ref, err := r.Reference(originHead, false); err == nil && ref.Type() == plumbing.SymbolicReference {
+		_, name, _ := strings.Cut(ref.Target().Short(), "/")
+		return plumbing.NewBranchReferenceName(name), nil
+	}
+	for _, name := range []string{"main", "master"} {
+		ref := plumbing.NewBranchReferenceName(name)
+		if _, err := r.Reference(ref, false); err == nil {
+			return ref, nil
+		}
+	}
+	return "", errors.New("could not determine the default branch")
+}
+
+// isMerged reports whether ref is reachable from the default branch.
+func isMerged(r *git.Repository, repo parse.Repo, ref *plumbing.Reference) (bool, error) {
+	target, err := defaultBranch(r, repo)
+	if err != nil {
+		return false, err
+	}
+	targetRef, err := r.Reference(target, true)
+	if err != nil {
+		return false, err
+	}
+	targetCommit, err := r.CommitObject(targetRef.Hash())
+	if err != nil {
+		return false, err
+	}
+	commit, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return false, err
+	}
+	return commit.IsAncestor(targetCommit)
+}
+
+// mergedBranches returns the sorted local branches that are merged into the
+// default branch, leaving out the default branch and the checked out one.
+func mergedBranches(r *git.Repository, repo parse.Repo) ([]string, error) {
+	target, err := defaultBranch(r, repo)
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	iter, err := r.Branches()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() == target || ref.Name() == head.Name() {
+			return nil
+		}
+		merged, err := isMerged(r, repo, ref)
+		if err != nil {
+			return err
+		}
+		if merged {
+			names = append(names, ref.Name().Short())
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// deleteBranch removes a local branch along with its config section.
+// The checked out branch is never deleted.
+func deleteBranch(r *git.Repository, name plumbing.ReferenceName) error {
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+	if head.Name() == name {
+		return fmt.Errorf("cannot delete the checked out branch %s", name.Short())
+	}
+	if err := r.Storer.RemoveReference(name); err != nil {
+		return err
+	}
+	err = r.DeleteBranch(name.Short())
+	if err != nil && !errors.Is(err, git.ErrBranchNotFound) {
+		return err
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(branchCmd)
+	branchCmd.AddCommand(branchListCmd, branchCreateCmd, branchDeleteCmd, branchMergedCmd)
+	for _, c := range branchCmd.Commands() {
+		c.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	}
+	branchDeleteCmd.Flags().BoolVarP(&branchForce, "force", "f", false, "delete the branch even if it is not merged")
+	branchMergedCmd.Flags().BoolVarP(&branchDelete, "delete", "d", false, "delete the merged branches")
+}
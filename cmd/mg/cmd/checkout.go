@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
+)
+
+var (
+	checkoutCreate bool
+	checkoutCmd    = &cobra.Command{
+		Use:   "checkout [branch]",
+		Short: "check out the same branch across all repos",
+		Long: `check out the same branch across all repos.
+
+Repos where the branch does not exist locally or on origin are skipped unless
+--create is passed. Repos with uncommitted changes are refused. Without a
+branch argument each repo is switched to its pinned branch from the config.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				branch := repo.Branch
+				if len(args) == 1 {
+					branch = args[0]
+				}
+				if branch == "" {
+					repoPrintf(repo.Path, "repo %s: no branch pinned\n", repo.Path)
+					return repoResult{Skipped: true}
+				}
+				return checkoutBranch(repo.Path, branch, checkoutCreate)
+			})
+			return printSummary(results, dryRunSummary(summary{Verb: "check out", Past: "checked out", Skipped: "skipped"}))
+		},
+	}
+)
+
+// checkoutBranch switches the worktree at path to branch. A missing local
+// branch is created from origin when a remote branch of the same name exists,
+// or from HEAD when create is set. With --dry-run it only prints the plan.
+func checkoutBranch(path, branch string, create bool) repoResult {
+	r, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	name := plumbing.NewBranchReferenceName(branch)
+	head, err := r.Head()
+	if err == nil && head.Name() == name {
+		repoPrintf(path, "repo %s: already on %s\n", path, branch)
+		return repoResult{Skipped: true}
+	}
+	st, err := w.Status()
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	if hasChanges(st) {
+		return repoResult{Err: errDirtyWorktree}
+	}
+
+	opts := &git.CheckoutOptions{Branch: name}
+	track := false
+	_, err = r.Reference(name, true)
+	switch {
+	case err == nil:
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		remote, rerr := r.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch), true)
+		switch {
+		case rerr == nil:
+			opts.Create = true
+			opts.Hash = remote.Hash()
+			track = true
+		case create:
+			opts.Create = true
+		default:
+			repoPrintf(path, "repo %s: branch %s does not exist\n", path, branch)
+			return repoResult{Skipped: true}
+		}
+	default:
+		return repoResult{Err: err}
+	}
+
+	if dryRun {
+		plan := fmt.Sprintf("repo %s: would check out %s", path, branch)
+		switch {
+		case track:
+			plan += fmt.Sprintf(" from %s/%s at %s", git.DefaultRemoteName, branch, opts.Hash.String()[:7])
+		case opts.Create:
+			plan += " as a new branch at HEAD"
+		}
+		repoPrintf(path, "%s\n", plan)
+		return repoResult{}
+	}
+	if err := w.Checkout(opts); err != nil {
+		return repoResult{Err: err}
+	}
+	if track {
+		err = r.CreateBranch(&config.Branch{
+			Name:   branch,
+			Remote: git.DefaultRemoteName,
+			Merge:  name,
+		})
+		if err != nil && !errors.Is(err, git.ErrBranchExists) {
+			return repoResult{Err: err}
+		}
+	}
+	repoPrintf(path, "successfully checked out %s in %s\n", branch, path)
+	return repoResult{}
+}
+
+func init() {
+	RootCmd.AddCommand(checkoutCmd)
+	checkoutCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	checkoutCmd.Flags().BoolVarP(&checkoutCreate, "create", "b", false, "create the branch at HEAD in repos where it does not exist")
+}
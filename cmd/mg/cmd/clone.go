@@ -1,11 +1,8 @@
 package cmd
 
 import (
-	"fmt"
-	"log"
 	"os"
 	"path/filepath"
-	"sync"
 
 	git "github.com/go-git/go-git/v5"
 	"github.com/spf13/cobra"
@@ -15,92 +12,115 @@ import (
 
 // cloneCmd represents the clone command
 var (
-	cloneCmd = &cobra.Command{
+	cloneDepth        int
+	cloneSingleBranch bool
+	cloneRef          string
+	cloneRecurse      bool
+	cloneBare         bool
+	cloneMirror       bool
+	cloneCmd          = &cobra.Command{
 		Use:   "clone",
 		Short: "ensure all repos defined in the config are cloned",
-		Run: func(_ *cobra.Command, args []string) {
-			type RepoError struct {
-				Error error
-				Repo  string
-			}
-			if jobs < 1 {
-				log.Println("jobs must be greater than 0")
-				os.Exit(1)
+		Args:  cobra.NoArgs,
+		Long: `ensure all repos defined in the config are cloned.
+
+--dry-run checks that the remote of every missing repo can be listed and
+shows the clones and directories that would be created.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkJobs(); err != nil {
+				return err
 			}
-			conf := GetConfig()
-			if len(args) > 0 {
-				log.Println("too many arguments")
-				os.Exit(1)
+			conf, err := GetConfig()
+			if err != nil {
+				return err
 			}
-			repoChan := make(chan parse.Repo, len(conf.Repos))
-			errs := []RepoError{}
-			alreadyCloned := 0
-			mutex := sync.Mutex{}
-			wg := sync.WaitGroup{}
-			wg.Add(len(conf.Repos))
-			cloneFunc := func() {
-				for repo := range repoChan {
-					_, err := git.PlainOpenWithOptions(repo.Path, &(git.PlainOpenOptions{DetectDotGit: true}))
-					if err == nil {
-						log.Printf("already cloned: %s\n", repo.Path)
-						mutex.Lock()
-						alreadyCloned++
-						mutex.Unlock()
-						wg.Done()
-						continue
-					} else if err == git.ErrRepositoryNotExists {
-						log.Printf("attempting clone: %s\n", repo.Path)
-						parentPath := filepath.Dir(repo.Path)
-						if _, err := os.Stat(parentPath); err != nil {
-							os.MkdirAll(parentPath, os.ModeDir|os.ModePerm)
-						}
-						_, err = git.PlainClone(repo.Path, false, &git.CloneOptions{
-							URL: repo.Remote,
-						})
-						if err != nil {
-							mutex.Lock()
-							errs = append(errs, RepoError{Error: err, Repo: repo.Path})
-							mutex.Unlock()
-							log.Printf("clone failed for %s: %v\n", repo.Path, err)
-							wg.Done()
-							continue
-						}
-						fmt.Printf("successfully cloned %s\n", repo.Path)
-						wg.Done()
-						continue
-					} else {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo.Path})
-						mutex.Unlock()
-						log.Printf("clone failed for %s: %v\n", repo.Path, err)
-						wg.Done()
-						continue
-					}
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				_, err := git.PlainOpenWithOptions(repo.Path, &(git.PlainOpenOptions{DetectDotGit: true}))
+				if err == nil {
+					repoLogf(repo.Path, "already cloned: %s\n", repo.Path)
+					return repoResult{Skipped: true}
+				} else if err != git.ErrRepositoryNotExists {
+					return repoResult{Err: err}
 				}
-			}
-			for i := 0; i < jobs; i++ {
-				go cloneFunc()
-			}
-			fmt.Println(len(conf.Repos))
-			for _, repo := range conf.Repos {
-				repoChan <- repo
-			}
-			close(repoChan)
-			fmt.Println("waiting...")
-			wg.Wait()
-			for _, err := range errs {
-				log.Printf("error pulling %s: %s\n", err.Repo, err.Error)
-			}
-			lenErrs := len(errs)
-			fmt.Println()
-			fmt.Printf("successfully cloned %d/%d repos\n", len(conf.Repos)-lenErrs, len(conf.Repos))
-			fmt.Printf("%d repos already cloned\n", alreadyCloned)
-			fmt.Printf("failed to clone %d/%d repos\n", lenErrs, len(conf.Repos))
+				repo.Remote = conf.ResolveRemote(repo.Remote)
+				opts, bare := cloneOptions(cmd, repo)
+				if opts.Auth, err = credentials.forURL(repo.Remote); err != nil {
+					return repoResult{Err: err}
+				}
+				if dryRun {
+					return clonePlan(repo.Path, opts, bare)
+				}
+				repoLogf(repo.Path, "attempting clone: %s\n", repo.Path)
+				parentPath := filepath.Dir(repo.Path)
+				if _, err := os.Stat(parentPath); err != nil {
+					os.MkdirAll(parentPath, os.ModeDir|os.ModePerm)
+				}
+				setPhase(repo.Path, "cloning")
+				opts.Progress = sideband(repo.Path)
+				if _, err := git.PlainCloneContext(cmd.Context(), repo.Path, bare, opts); err != nil {
+					return repoResult{Err: err}
+				}
+				repoPrintf(repo.Path, "successfully cloned %s\n", repo.Path)
+				return repoResult{}
+			})
+			return printSummary(results, dryRunSummary(summary{Verb: "clone", Past: "cloned", Skipped: "already cloned"}))
 		},
 	}
 )
 
+// cloneOptions builds the go-git clone options for a repo from its
+// configured clone settings. Flags given on the command line take precedence
+// over the per-repo settings. The returned bool reports whether the clone
+// should be bare.
+func cloneOptions(cmd *cobra.Command, repo parse.Repo) (*git.CloneOptions, bool) {
+	settings := parse.CloneOptions{}
+	if repo.Clone != nil {
+		settings = *repo.Clone
+	}
+	ref := repo.Branch
+	flags := cmd.Flags()
+	if flags.Changed("depth") {
+		settings.Depth = cloneDepth
+	}
+	if flags.Changed("single-branch") {
+		settings.SingleBranch = cloneSingleBranch
+	}
+	if flags.Changed("recurse-submodules") {
+		settings.RecurseSubmodules = cloneRecurse
+	}
+	if flags.Changed("bare") {
+		settings.Bare = cloneBare
+	}
+	if flags.Changed("mirror") {
+		settings.Mirror = cloneMirror
+	}
+	if flags.Changed("branch") {
+		ref = cloneRef
+	}
+
+	opts := &git.CloneOptions{
+		URL:          repo.Remote,
+		Depth:        settings.Depth,
+		SingleBranch: settings.SingleBranch,
+		Mirror:       settings.Mirror,
+	}
+	if ref != "" {
+		opts.ReferenceName = referenceName(ref)
+	}
+	if settings.RecurseSubmodules {
+		opts.RecurseSubmodules = git.DefaultSubmoduleRecursionDepth
+	}
+	// a mirror is always bare, just like git clone --mirror
+	return opts, settings.Bare || settings.Mirror
+}
+
 func init() {
 	RootCmd.AddCommand(cloneCmd)
 	cloneCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	cloneCmd.Flags().IntVar(&cloneDepth, "depth", 0, "create shallow clones truncated to this many commits")
+	cloneCmd.Flags().BoolVar(&cloneSingleBranch, "single-branch", false, "only fetch the history of the cloned branch")
+	cloneCmd.Flags().StringVarP(&cloneRef, "branch", "b", "", "branch or ref to check out instead of the remote HEAD")
+	cloneCmd.Flags().BoolVar(&cloneRecurse, "recurse-submodules", false, "initialize and clone submodules recursively")
+	cloneCmd.Flags().BoolVar(&cloneBare, "bare", false, "create bare repositories")
+	cloneCmd.Flags().BoolVar(&cloneMirror, "mirror", false, "create mirror repositories (implies --bare)")
 }
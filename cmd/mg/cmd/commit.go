@@ -1,123 +1,370 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
-	"sync"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
 
 	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
 )
 
-var commitMessage string
+var errNoIdentity = errors.New("no commit identity")
+
+var (
+	commitMessage     string
+	commitFile        string
+	commitAll         bool
+	commitAuthor      string
+	commitAmend       bool
+	commitAllowEmpty  bool
+	commitSign        bool
+	commitSignKey     string
+	commitInteractive bool
+	commitNoVerify    bool
+	commitTemplate    string
+)
 
 // commitCmd represents the commit command
 var commitCmd = &cobra.Command{
 	Use:   "commit",
 	Short: "commit staged changes across all repos with the same message",
-	Run: func(_ *cobra.Command, args []string) {
-		type RepoError struct {
-			Error error
-			Repo  string
-		}
-		if jobs < 1 {
-			log.Println("jobs must be greater than 0")
-			os.Exit(1)
-		}
-		if commitMessage == "" {
-			log.Println("commit message is required (-m)")
-			os.Exit(1)
-		}
-		conf := GetConfig()
-		if len(args) > 0 {
-			log.Println("too many arguments")
-			os.Exit(1)
-		}
-		repoChan := make(chan string, len(conf.Repos))
-		var (
-			errs    []RepoError
-			skipped int
-			mutex   sync.Mutex
-			wg      sync.WaitGroup
-		)
-		wg.Add(len(conf.Repos))
-		for i := 0; i < jobs; i++ {
-			go func() {
-				for repo := range repoChan {
-					r, err := git.PlainOpenWithOptions(repo, &git.PlainOpenOptions{DetectDotGit: true})
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						wg.Done()
-						continue
-					}
-					w, err := r.Worktree()
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						wg.Done()
-						continue
-					}
-					st, err := w.Status()
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						wg.Done()
-						continue
-					}
-					// Check if there are any staged changes
-					hasStagedChanges := false
-					for _, s := range st {
-						if s.Staging != git.Unmodified && s.Staging != git.Untracked {
-							hasStagedChanges = true
-							break
-						}
-					}
-					if !hasStagedChanges {
-						mutex.Lock()
-						skipped++
-						mutex.Unlock()
-						fmt.Printf("repo %s: nothing staged to commit\n", repo)
-						wg.Done()
-						continue
-					}
-					_, err = w.Commit(commitMessage, &git.CommitOptions{})
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						log.Printf("commit failed for %s: %v\n", repo, err)
-						wg.Done()
-						continue
-					}
-					fmt.Printf("successfully committed in %s\n", repo)
-					wg.Done()
+	Args:  cobra.NoArgs,
+	Long: `commit staged changes across all repos with the same message.
+
+Repos with nothing to commit are skipped unless --allow-empty is given. With
+--all, modified and deleted tracked files are staged first; untracked files
+are never added. --amend replaces the last commit, keeping its message and
+author unless a new message or --author is given. --interactive picks the
+repos to commit from a checklist of those with changes.
+
+The pre-commit, commit-msg and post-commit hooks of each repo are run like
+git does, from .git/hooks or core.hooksPath. A repo whose pre-commit or
+commit-msg hook fails is not committed. --no-verify skips the pre-commit and
+commit-msg hooks.
+
+Messages given with -m or --template are Go templates, executed for each repo
+with .Path, .Name, .Remote, .Branch and .Tags, e.g.
+
+  mg commit -m "[{{.Name}}] bump shared lib to v2"
+  mg commit -m 'bump shared lib ({{join ", " .Tags}})'
+
+--dry-run prints the files and message each repo would be committed with
+instead of committing.`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if err := checkJobs(); err != nil {
+			return err
+		}
+		sources := 0
+		for _, source := range []string{commitMessage, commitFile, commitTemplate} {
+			if source != "" {
+				sources++
+			}
+		}
+		if sources > 1 {
+			return usageErrorf("only one of -m, -F and --template can be used")
+		}
+		message := commitMessage
+		if commitFile != "" {
+			b, err := readMessageFile(commitFile)
+			if err != nil {
+				return &usageError{err}
+			}
+			message = string(b)
+		}
+		if commitTemplate != "" {
+			b, err := os.ReadFile(commitTemplate)
+			if err != nil {
+				return &usageError{err}
+			}
+			message = string(b)
+		}
+		if message == "" && !commitAmend {
+			return usageErrorf("commit message is required (-m, -F or --template)")
+		}
+		// messages read with -F are used as is
+		var tmpl *template.Template
+		if message != "" && commitFile == "" {
+			var err error
+			if tmpl, err = parseMessage(message); err != nil {
+				return &usageError{err}
+			}
+		}
+		var author *object.Signature
+		if commitAuthor != "" {
+			var err error
+			author, err = parseIdentity(commitAuthor)
+			if err != nil {
+				return &usageError{err}
+			}
+		}
+		conf, err := GetConfig()
+		if err != nil {
+			return err
+		}
+		repos := conf.Repos
+		if commitInteractive {
+			repos, err = chooseRepos("commit in", commitCandidates(conf.Repos, commitAllowEmpty || commitAmend))
+			if err != nil || len(repos) == 0 {
+				return err
+			}
+		}
+		results := forEachRepoInOrder(cmd.Context(), repos, jobs, func(repo parse.Repo) repoResult {
+			r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			w, err := r.Worktree()
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			st, err := w.Status()
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			// resolve the identity first so nothing is staged for a
+			// commit that cannot be made
+			opts, msg, err := commitOptions(r, message, author)
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			if tmpl != nil {
+				if msg, err = renderMessage(tmpl, repo, r); err != nil {
+					return repoResult{Err: err}
+				}
+			}
+			if commitSign && !dryRun {
+				if opts.Signer, err = repoSigner(repo.Path, conf.Signing, commitSignKey); err != nil {
+					return repoResult{Err: err}
+				}
+			}
+			if commitAll && !dryRun {
+				if err := stageTracked(w, st); err != nil {
+					return repoResult{Err: err}
+				}
+				if st, err = w.Status(); err != nil {
+					return repoResult{Err: err}
+				}
+			}
+			// Check if there are any staged changes
+			hasStagedChanges := false
+			for _, s := range st {
+				if s.Staging != git.Unmodified && s.Staging != git.Untracked {
+					hasStagedChanges = true
+					break
+				}
+			}
+			if dryRun && commitAll {
+				// nothing was staged, count what --all would stage
+				hasStagedChanges = hasChanges(st)
+			}
+			if !hasStagedChanges && !commitAllowEmpty && !commitAmend {
+				repoPrintf(repo.Path, "repo %s: nothing staged to commit\n", repo.Path)
+				return repoResult{Skipped: true}
+			}
+			if dryRun {
+				repoPrintf(repo.Path, "repo %s: would commit%s\n  with message:\n%s\n", repo.Path, commitFiles(st), indent(msg))
+				return repoResult{}
+			}
+			h, err := repoHooks(r, w, repo.Path)
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			if !commitNoVerify {
+				setPhase(repo.Path, "running hooks")
+				if err := h.run("pre-commit"); err != nil {
+					return repoResult{Err: err}
+				}
+				if msg, err = h.commitMsg(msg); err != nil {
+					return repoResult{Err: err}
 				}
-			}()
-		}
-		for _, repo := range conf.Repos {
-			repoChan <- repo.Path
-		}
-		close(repoChan)
-		wg.Wait()
-		for _, err := range errs {
-			log.Printf("error committing %s: %s\n", err.Repo, err.Error)
-		}
-		lenErrs := len(errs)
-		committed := len(conf.Repos) - lenErrs - skipped
-		fmt.Println()
-		fmt.Printf("successfully committed %d/%d repos\n", committed, len(conf.Repos))
-		fmt.Printf("%d repos had nothing staged\n", skipped)
-		fmt.Printf("failed to commit %d/%d repos\n", lenErrs, len(conf.Repos))
+			}
+			setPhase(repo.Path, "committing")
+			_, err = w.Commit(msg, opts)
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			repoPrintf(repo.Path, "successfully committed in %s\n", repo.Path)
+			// like git, a failing post-commit hook does not undo the commit
+			if err := h.run("post-commit"); err != nil {
+				repoLogf(repo.Path, "repo %s: %s\n", repo.Path, err)
+			}
+			return repoResult{}
+		})
+		return printSummary(results, dryRunSummary(summary{Verb: "commit", Past: "committed", Skipped: "had nothing staged"}))
 	},
 }
 
+// commitOptions resolves the author, committer and message of a commit in r.
+// When amending, the message and author of the replaced commit are kept
+// unless new ones are given.
+func commitOptions(r *git.Repository, message string, author *object.Signature) (*git.CommitOptions, string, error) {
+	committer, err := commitIdentity(r)
+	if err != nil {
+		return nil, "", err
+	}
+	opts := &git.CommitOptions{
+		Amend: commitAmend,
+		// an amend may only change the message
+		AllowEmptyCommits: commitAllowEmpty || commitAmend,
+		Committer:         committer,
+	}
+	if commitAmend {
+		head, err := r.Head()
+		if err != nil {
+			return nil, "", fmt.Errorf("nothing to amend: %w", err)
+		}
+		prev, err := r.CommitObject(head.Hash())
+		if err != nil {
+			return nil, "", err
+		}
+		if message == "" {
+			message = prev.Message
+		}
+		opts.Author = &prev.Author
+	}
+	if author == nil && opts.Author == nil {
+		if author, err = authorIdentity(r); err != nil {
+			return nil, "", err
+		}
+	}
+	if author != nil {
+		a := *author
+		a.When = committer.When
+		opts.Author = &a
+	}
+	return opts, message, nil
+}
+
+// commitIdentity returns the committer signature for r, read like git does
+// from GIT_COMMITTER_NAME and GIT_COMMITTER_EMAIL, then committer.name and
+// committer.email, then user.name and user.email in the repo, global and
+// system config.
+func commitIdentity(r *git.Repository) (*object.Signature, error) {
+	return gitIdentity(r, "committer")
+}
+
+// authorIdentity returns the author signature for r, read like
+// commitIdentity but from GIT_AUTHOR_NAME, GIT_AUTHOR_EMAIL and author.*.
+func authorIdentity(r *git.Repository) (*object.Signature, error) {
+	return gitIdentity(r, "author")
+}
+
+// gitIdentity returns the signature for role, author or committer.
+func gitIdentity(r *git.Repository, role string) (*object.Signature, error) {
+	cfg, err := r.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return nil, err
+	}
+	name, email := cfg.User.Name, cfg.User.Email
+	scoped := cfg.Committer
+	if role == "author" {
+		scoped = cfg.Author
+	}
+	if scoped.Name != "" {
+		name = scoped.Name
+	}
+	if scoped.Email != "" {
+		email = scoped.Email
+	}
+	env := "GIT_" + strings.ToUpper(role)
+	if v := os.Getenv(env + "_NAME"); v != "" {
+		name = v
+	}
+	if v := os.Getenv(env + "_EMAIL"); v != "" {
+		email = v
+	}
+	if name == "" || email == "" {
+		return nil, fmt.Errorf("%w: set user.name and user.email with git config", errNoIdentity)
+	}
+	return &object.Signature{Name: name, Email: email, When: time.Now()}, nil
+}
+
+// parseIdentity parses an identity in the form "Name <email>".
+func parseIdentity(s string) (*object.Signature, error) {
+	name, rest, ok := strings.Cut(s, "<")
+	email, tail, closed := strings.Cut(rest, ">")
+	name, email = strings.TrimSpace(name), strings.TrimSpace(email)
+	if !ok || !closed || strings.TrimSpace(tail) != "" || name == "" || email == "" {
+		return nil, fmt.Errorf("invalid identity %q, expected \"Name <email>\"", s)
+	}
+	return &object.Signature{Name: name, Email: email}, nil
+}
+
+// stageTracked stages modified and deleted tracked files, like git commit -a.
+func stageTracked(w *git.Worktree, st git.Status) error {
+	for path, s := range st {
+		switch {
+		case s.Staging == git.Untracked:
+			continue
+		case s.Worktree == git.Deleted:
+			if _, err := w.Remove(path); err != nil {
+				return err
+			}
+		case s.Worktree != git.Unmodified:
+			if _, err := w.Add(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// commitFiles lists the files a commit would contain given the worktree
+// status, including those --all would stage, like git status --short.
+func commitFiles(st git.Status) string {
+	var files []string
+	for path, s := range st {
+		switch {
+		case s.Staging != git.Unmodified && s.Staging != git.Untracked:
+			files = append(files, fmt.Sprintf("\n  %c %s", s.Staging, path))
+		case commitAll && s.Staging != git.Untracked && s.Worktree != git.Unmodified:
+			files = append(files, fmt.Sprintf("\n  %c %s", s.Worktree, path))
+		}
+	}
+	sort.Strings(files)
+	return strings.Join(files, "")
+}
+
+// indent indents every line of a message for display.
+func indent(message string) string {
+	lines := strings.Split(strings.TrimRight(message, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "    " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// readMessageFile reads a commit message from path, or from stdin if path
+// is "-".
+func readMessageFile(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
 func init() {
 	RootCmd.AddCommand(commitCmd)
 	commitCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
 	commitCmd.Flags().StringVarP(&commitMessage, "message", "m", "", "commit message")
+	commitCmd.Flags().StringVarP(&commitFile, "file", "F", "", "read the commit message from a file, or - for stdin")
+	commitCmd.Flags().BoolVarP(&commitAll, "all", "a", false, "stage modified and deleted tracked files before committing")
+	commitCmd.Flags().StringVar(&commitAuthor, "author", "", "override the commit author, as \"Name <email>\"")
+	commitCmd.Flags().BoolVar(&commitAmend, "amend", false, "replace the last commit instead of adding a new one")
+	commitCmd.Flags().BoolVar(&commitAllowEmpty, "allow-empty", false, "commit even if nothing is staged")
+	commitCmd.Flags().BoolVarP(&commitSign, "sign", "S", false, "sign the commit with the configured OpenPGP or SSH key")
+	commitCmd.Flags().StringVar(&commitSignKey, "sign-key", "", "OpenPGP keyring or SSH key to sign with, instead of the configured key")
+	commitCmd.Flags().BoolVar(&commitInteractive, "interactive", false, "choose the repos to commit in from a checklist")
+	commitCmd.Flags().BoolVarP(&commitNoVerify, "no-verify", "n", false, "skip the pre-commit and commit-msg hooks")
+	commitCmd.Flags().StringVar(&commitTemplate, "template", "", "read the commit message template from a file")
 }
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+)
+
+func TestCommitOptions_AuthorAndCommitter(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	for _, env := range []string{"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(env, "")
+	}
+	r, err := git.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.User.Name, cfg.User.Email = "Build Bot", "bot@example.com"
+	cfg.Author.Name, cfg.Author.Email = "Alice", "alice@example.com"
+	if err := r.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, _, err := commitOptions(r, "message", nil)
+	if err != nil {
+		t.Fatalf("commitOptions() unexpected error: %v", err)
+	}
+	if opts.Author.Name != "Alice" || opts.Author.Email != "alice@example.com" {
+		t.Errorf("expected the author from author.*, got %s <%s>", opts.Author.Name, opts.Author.Email)
+	}
+	if opts.Committer.Name != "Build Bot" || opts.Committer.Email != "bot@example.com" {
+		t.Errorf("expected the committer from user.*, got %s <%s>", opts.Committer.Name, opts.Committer.Email)
+	}
+	if !opts.Author.When.Equal(opts.Committer.When) {
+		t.Errorf("expected the author and committer dates to match")
+	}
+
+	t.Setenv("GIT_AUTHOR_NAME", "Bob")
+	t.Setenv("GIT_AUTHOR_EMAIL", "bob@example.com")
+	opts, _, err = commitOptions(r, "message", nil)
+	if err != nil {
+		t.Fatalf("commitOptions() unexpected error: %v", err)
+	}
+	if opts.Author.Name != "Bob" || opts.Author.Email != "bob@example.com" {
+		t.Errorf("expected the author from GIT_AUTHOR_*, got %s <%s>", opts.Author.Name, opts.Author.Email)
+	}
+	if opts.Committer.Name != "Build Bot" {
+		t.Errorf("expected GIT_AUTHOR_* to leave the committer alone, got %s", opts.Committer.Name)
+	}
+}
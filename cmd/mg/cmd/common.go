@@ -1,32 +1,83 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
+	"github.com/charmbracelet/x/term"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/taigrr/mg/parse"
 )
 
-func GetConfig() parse.MGConfig {
+var errDirtyWorktree = errors.New("worktree has uncommitted changes")
+
+// GetConfig loads the mg config, migrating the myrepos config if there is
+// no mg config yet. Errors are configErrors.
+func GetConfig() (parse.MGConfig, error) {
 	conf, err := parse.LoadMGConfig()
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Try to load mr config instead
-			mrconf, err := parse.LoadMRConfig()
-			if err != nil {
-				log.Println(err)
-				os.Exit(1)
-			}
+	if os.IsNotExist(err) {
+		// Try to load mr config instead
+		mrconf, err := parse.LoadMRConfig()
+		if err != nil {
+			return conf, &configError{err}
+		}
 
-			conf = mrconf.ToMGConfig()
+		conf = mrconf.ToMGConfig()
+		if dryRun {
+			log.Println("would migrate mrconfig to mgconfig")
+		} else {
 			log.Println("migrated mrconfig to mgconfig")
-			err = conf.Save()
-			if err != nil {
-				log.Println(err)
-				os.Exit(1)
+			if err := conf.Save(); err != nil {
+				return conf, &configError{err}
 			}
 		}
+	} else if err != nil {
+		return conf, &configError{err}
 	}
 	conf.ExpandPaths()
-	return conf
+	deps, err := resolveDependencies(conf)
+	if err != nil {
+		return conf, &configError{fmt.Errorf("invalid config: %w", err)}
+	}
+	dependencies = deps
+	credentials = newAuthenticator(conf.Auth, conf.KnownHosts)
+	return conf, nil
+}
+
+// referenceName turns a user supplied branch name or full ref into a
+// reference name. Anything not starting with refs/ is treated as a branch.
+func referenceName(ref string) plumbing.ReferenceName {
+	if strings.HasPrefix(ref, "refs/") {
+		return plumbing.ReferenceName(ref)
+	}
+	return plumbing.NewBranchReferenceName(ref)
+}
+
+// hasChanges reports whether a worktree status contains staged or unstaged
+// changes to tracked files. Untracked files are ignored, as they are by git
+// when switching branches.
+func hasChanges(st git.Status) bool {
+	for _, s := range st {
+		if s.Staging == git.Untracked || (s.Staging == git.Unmodified && s.Worktree == git.Unmodified) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// promptPassword asks for a secret on the terminal without echoing it.
+func promptPassword(prompt string) ([]byte, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return nil, errors.New("cannot prompt for a passphrase without a terminal")
+	}
+	defer progress.pause()()
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	return b, err
 }
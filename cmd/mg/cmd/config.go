@@ -11,8 +11,9 @@ var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "",
 	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Println("config called")
+		return nil
 	},
 }
 
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/taigrr/mg/parse"
+)
+
+// dependencies maps a repo path to the paths of the repos that have to be
+// processed before it. It is filled in by GetConfig and used by
+// forEachRepoInOrder to schedule repos in dependency order.
+var dependencies map[string][]string
+
+// resolveDependencies combines the DependsOn entries in the config with the
+// dependencies between registered Go modules found in each repo's go.mod.
+// Only cycles among DependsOn entries are an error. Go modules may require
+// each other in a cycle, e.g. a module requiring an older version of one
+// that requires it, so requirements that would close a cycle are ignored.
+func resolveDependencies(conf parse.MGConfig) (map[string][]string, error) {
+	deps, err := conf.Dependencies()
+	if err != nil {
+		return nil, err
+	}
+	goDeps := goModDependencies(conf.Repos)
+	paths := make([]string, 0, len(goDeps))
+	for path := range goDeps {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, dep := range goDeps[path] {
+			deps[path] = append(deps[path], dep)
+			if parse.CheckDependencies(deps) != nil {
+				deps[path] = deps[path][:len(deps[path])-1]
+			}
+		}
+	}
+	return deps, nil
+}
+
+// goModDependencies reads the go.mod at the root of every repo and returns,
+// for each repo, the repos providing modules it requires.
+func goModDependencies(repos []parse.Repo) map[string][]string {
+	mods := map[string]parse.GoMod{}
+	provided := map[string]string{}
+	for _, repo := range repos {
+		b, err := os.ReadFile(filepath.Join(repo.Path, "go.mod"))
+		if err != nil {
+			continue
+		}
+		mod, err := parse.ParseGoMod(b)
+		if err != nil {
+			continue
+		}
+		mods[repo.Path] = mod
+		provided[mod.Module] = repo.Path
+	}
+	deps := map[string][]string{}
+	for path, mod := range mods {
+		for _, req := range mod.Requires {
+			if dep, ok := provided[req]; ok && dep != path {
+				deps[path] = append(deps[path], dep)
+			}
+		}
+	}
+	return deps
+}
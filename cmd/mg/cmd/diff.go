@@ -3,12 +3,13 @@ package cmd
 import (
 	"fmt"
 	"log"
-	"os"
 	"sort"
 	"sync"
 
 	git "github.com/go-git/go-git/v5"
 	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
 )
 
 type repoDiff struct {
@@ -20,97 +21,66 @@ type repoDiff struct {
 var diffCmd = &cobra.Command{
 	Use:   "diff",
 	Short: "show uncommitted changes across all repos",
-	Run: func(_ *cobra.Command, args []string) {
-		type RepoError struct {
-			Error error
-			Repo  string
-		}
-		if jobs < 1 {
-			log.Println("jobs must be greater than 0")
-			os.Exit(1)
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if err := checkJobs(); err != nil {
+			return err
 		}
-		conf := GetConfig()
-		if len(args) > 0 {
-			log.Println("too many arguments")
-			os.Exit(1)
+		conf, err := GetConfig()
+		if err != nil {
+			return err
 		}
-		repoChan := make(chan string, len(conf.Repos))
 		var (
-			errs  []RepoError
 			diffs []repoDiff
 			mutex sync.Mutex
-			wg    sync.WaitGroup
 		)
-		wg.Add(len(conf.Repos))
-		for i := 0; i < jobs; i++ {
-			go func() {
-				for repo := range repoChan {
-					r, err := git.PlainOpenWithOptions(repo, &git.PlainOpenOptions{DetectDotGit: true})
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						wg.Done()
-						continue
-					}
-					w, err := r.Worktree()
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						wg.Done()
-						continue
-					}
-					st, err := w.Status()
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						wg.Done()
-						continue
-					}
-					if st.IsClean() {
-						wg.Done()
-						continue
-					}
-					rd := repoDiff{Path: repo}
-					for file, status := range st {
-						code := status.Worktree
-						if code == git.Unmodified {
-							code = status.Staging
-						}
-						var prefix string
-						switch code {
-						case git.Modified:
-							prefix = "M"
-						case git.Added:
-							prefix = "A"
-						case git.Deleted:
-							prefix = "D"
-						case git.Renamed:
-							prefix = "R"
-						case git.Copied:
-							prefix = "C"
-						case git.Untracked:
-							prefix = "?"
-						default:
-							continue
-						}
-						rd.Changes = append(rd.Changes, fmt.Sprintf("  %s %s", prefix, file))
-					}
-					sort.Strings(rd.Changes)
-					mutex.Lock()
-					diffs = append(diffs, rd)
-					mutex.Unlock()
-					wg.Done()
+		results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+			r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			w, err := r.Worktree()
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			st, err := w.Status()
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			if st.IsClean() {
+				return repoResult{Skipped: true}
+			}
+			rd := repoDiff{Path: repo.Path}
+			for file, status := range st {
+				code := status.Worktree
+				if code == git.Unmodified {
+					code = status.Staging
 				}
-			}()
-		}
-		for _, repo := range conf.Repos {
-			repoChan <- repo.Path
-		}
-		close(repoChan)
-		wg.Wait()
+				var prefix string
+				switch code {
+				case git.Modified:
+					prefix = "M"
+				case git.Added:
+					prefix = "A"
+				case git.Deleted:
+					prefix = "D"
+				case git.Renamed:
+					prefix = "R"
+				case git.Copied:
+					prefix = "C"
+				case git.Untracked:
+					prefix = "?"
+				default:
+					continue
+				}
+				rd.Changes = append(rd.Changes, fmt.Sprintf("  %s %s", prefix, file))
+			}
+			sort.Strings(rd.Changes)
+			mutex.Lock()
+			diffs = append(diffs, rd)
+			mutex.Unlock()
+			return repoResult{}
+		})
 
 		sort.Slice(diffs, func(i, j int) bool {
 			return diffs[i].Path < diffs[j].Path
@@ -124,14 +94,19 @@ var diffCmd = &cobra.Command{
 			fmt.Println()
 		}
 
-		for _, err := range errs {
-			log.Printf("error reading %s: %s\n", err.Repo, err.Error)
+		failed := 0
+		for _, res := range results {
+			if res.Err != nil {
+				failed++
+				log.Printf("error reading %s: %s\n", res.Repo, res.Err)
+			}
 		}
 
-		fmt.Printf("%d/%d repos have changes\n", len(diffs), len(conf.Repos))
-		if len(errs) > 0 {
-			fmt.Printf("failed to read %d/%d repos\n", len(errs), len(conf.Repos))
+		fmt.Printf("%d/%d repos have changes\n", len(diffs), len(results))
+		if failed > 0 {
+			fmt.Printf("failed to read %d/%d repos\n", failed, len(results))
 		}
+		return reportResults(results, summary{Verb: "read", Skipped: "clean"})
 	},
 }
 
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// dryRun is set by the global --dry-run flag. Commands that change repos,
+// the config or other files print what they would do instead, using only
+// read-only operations such as listing the refs of a remote.
+var dryRun bool
+
+// dryRunSummary adjusts s for --dry-run, where repos are only checked.
+func dryRunSummary(s summary) summary {
+	if dryRun {
+		s.Verb, s.Past = "check", "checked"
+	}
+	return s
+}
+
+// listRemote lists the refs of the named remote, like git ls-remote.
+func listRemote(r *git.Repository, name string) (map[plumbing.ReferenceName]*plumbing.Reference, error) {
+	remote, err := r.Remote(name)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := remoteAuth(r, name)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return nil, err
+	}
+	listed := map[plumbing.ReferenceName]*plumbing.Reference{}
+	for _, ref := range refs {
+		listed[ref.Name()] = ref
+	}
+	return listed, nil
+}
+
+// resolveListed follows symbolic refs such as HEAD within listed refs.
+func resolveListed(listed map[plumbing.ReferenceName]*plumbing.Reference, name plumbing.ReferenceName) (*plumbing.Reference, bool) {
+	for range 10 {
+		ref, ok := listed[name]
+		if !ok {
+			return nil, false
+		}
+		if ref.Type() != plumbing.SymbolicReference {
+			return ref, true
+		}
+		name = ref.Target()
+	}
+	return nil, false
+}
+
+// pullPlan prints what pulling ref from origin would change in r: the
+// remote-tracking branches a fetch would update and the new HEAD. A HEAD
+// that is ahead of ref or has diverged from it is marked, as the pull would
+// be rejected.
+func pullPlan(r *git.Repository, path string, ref plumbing.ReferenceName) repoResult {
+	listed, err := listRemote(r, git.DefaultRemoteName)
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	if ref == "" {
+		// like go-git, pull the branch HEAD of the remote points to
+		ref = plumbing.HEAD
+	}
+	target, ok := resolveListed(listed, ref)
+	if !ok {
+		return repoResult{Err: fmt.Errorf("%s not found on %s", ref, git.DefaultRemoteName)}
+	}
+	lines := trackingPlan(r, listed)
+	head, err := r.Head()
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	ahead := false
+	if head.Hash() != target.Hash() {
+		line := fmt.Sprintf("  %s %s..%s", head.Name().Short(), head.Hash().String()[:7], target.Hash().String()[:7])
+		_, err := r.CommitObject(target.Hash())
+		switch {
+		case isAncestor(r, target.Hash(), head.Hash()):
+			ahead = true
+			line = fmt.Sprintf("  %s ahead of %s (not a fast-forward, would be rejected)", head.Name().Short(), target.Hash().String()[:7])
+		case err == nil && !isAncestor(r, head.Hash(), target.Hash()):
+			line += " (not a fast-forward, would be rejected)"
+		case err != nil && hasLocalCommits(r, head):
+			// the new commits are not fetched yet, so it is only known
+			// that they have to include the local ones
+			line += " (has local commits, likely not a fast-forward)"
+		}
+		lines = append(lines, line)
+	}
+	if ahead && len(lines) == 1 {
+		// like go-git, a local branch ahead of the remote is up to date
+		// when the fetch brings nothing new
+		repoPrintf(path, "repo %s: already up to date, %s is ahead\n", path, head.Name().Short())
+		return repoResult{Skipped: true}
+	}
+	if len(lines) == 0 {
+		repoPrintf(path, "repo %s: already up to date\n", path)
+		return repoResult{Skipped: true}
+	}
+	sort.Strings(lines)
+	repoPrintf(path, "repo %s: would update\n%s\n", path, strings.Join(lines, "\n"))
+	return repoResult{}
+}
+
+// trackingPlan returns a line for every remote-tracking branch of origin
+// that fetching the listed refs would create or update.
+func trackingPlan(r *git.Repository, listed map[plumbing.ReferenceName]*plumbing.Reference) []string {
+	var lines []string
+	for name, remoteRef := range listed {
+		if !name.IsBranch() || remoteRef.Type() != plumbing.HashReference {
+			continue
+		}
+		tracking := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, name.Short())
+		local, err := r.Reference(tracking, true)
+		switch {
+		case err != nil:
+			lines = append(lines, fmt.Sprintf("  %s new at %s", tracking.Short(), remoteRef.Hash().String()[:7]))
+		case local.Hash() != remoteRef.Hash():
+			lines = append(lines, fmt.Sprintf("  %s %s..%s", tracking.Short(), local.Hash().String()[:7], remoteRef.Hash().String()[:7]))
+		}
+	}
+	return lines
+}
+
+// fetchPlan prints the remote-tracking branches fetching origin would
+// create or update in r.
+func fetchPlan(r *git.Repository, path string) repoResult {
+	listed, err := listRemote(r, git.DefaultRemoteName)
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	lines := trackingPlan(r, listed)
+	if len(lines) == 0 {
+		repoPrintf(path, "repo %s: already up to date\n", path)
+		return repoResult{Skipped: true}
+	}
+	sort.Strings(lines)
+	repoPrintf(path, "repo %s: would update\n%s\n", path, strings.Join(lines, "\n"))
+	return repoResult{}
+}
+
+// pushPlan prints the branches pushing r to origin would create or update.
+// Updates that are not fast-forwards are marked, as the push would be
+// rejected.
+func pushPlan(r *git.Repository, path string) repoResult {
+	listed, err := listRemote(r, git.DefaultRemoteName)
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	branches, err := r.Branches()
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	var lines []string
+	err = branches.ForEach(func(local *plumbing.Reference) error {
+		remoteRef, ok := listed[local.Name()]
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("  %s new branch at %s", local.Name().Short(), local.Hash().String()[:7]))
+		case remoteRef.Hash() != local.Hash():
+			line := fmt.Sprintf("  %s %s..%s", local.Name().Short(), remoteRef.Hash().String()[:7], local.Hash().String()[:7])
+			if !isAncestor(r, remoteRef.Hash(), local.Hash()) {
+				line += " (not a fast-forward, would be rejected)"
+			}
+			lines = append(lines, line)
+		}
+		return nil
+	})
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	if len(lines) == 0 {
+		repoPrintf(path, "repo %s: already up to date\n", path)
+		return repoResult{Skipped: true}
+	}
+	sort.Strings(lines)
+	repoPrintf(path, "repo %s: would push\n%s\n", path, strings.Join(lines, "\n"))
+	return repoResult{}
+}
+
+// hasLocalCommits reports whether head has commits its remote-tracking
+// branch on origin does not.
+func hasLocalCommits(r *git.Repository, head *plumbing.Reference) bool {
+	tracking, err := r.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, head.Name().Short()), true)
+	if err != nil {
+		return false
+	}
+	return tracking.Hash() != head.Hash() && !isAncestor(r, head.Hash(), tracking.Hash())
+}
+
+// isAncestor reports whether ancestor is known locally and reachable from
+// hash.
+func isAncestor(r *git.Repository, ancestor, hash plumbing.Hash) bool {
+	a, err := r.CommitObject(ancestor)
+	if err != nil {
+		return false
+	}
+	c, err := r.CommitObject(hash)
+	if err != nil {
+		return false
+	}
+	ok, err := a.IsAncestor(c)
+	return err == nil && ok
+}
+
+// clonePlan checks that the remote of a clone can be listed and prints what
+// cloning it would create.
+func clonePlan(path string, opts *git.CloneOptions, bare bool) repoResult {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{opts.URL},
+	})
+	listed, err := remote.List(&git.ListOptions{Auth: opts.Auth})
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	ref := opts.ReferenceName
+	if ref == "" {
+		ref = plumbing.HEAD
+		for _, l := range listed {
+			if l.Name() == plumbing.HEAD && l.Type() == plumbing.SymbolicReference {
+				ref = l.Target()
+			}
+		}
+	}
+	kind := "clone"
+	if bare {
+		kind = "bare clone"
+	}
+	lines := []string{fmt.Sprintf("  %s of %s at %s", kind, opts.URL, ref.Short())}
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		lines = append(lines, "  directory "+filepath.Dir(path))
+	}
+	repoPrintf(path, "repo %s: would create\n%s\n", path, strings.Join(lines, "\n"))
+	return repoResult{}
+}
+
+func init() {
+	RootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "show what would be done without changing anything")
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of mg, so scripts and CI can tell repos failing apart from mg
+// being called wrong.
+const (
+	ExitOK        = 0
+	ExitFailed    = 1   // some repos failed
+	ExitUsage     = 2   // invalid arguments, flags or config
+	ExitCancelled = 130 // interrupted, as shells report SIGINT
+)
+
+var (
+	errCancelled   = errors.New("cancelled")
+	errReposFailed = errors.New("some repos failed")
+)
+
+// usageError is an error in the arguments or flags a command was called
+// with.
+type usageError struct {
+	err error
+}
+
+func usageErrorf(format string, a ...any) error {
+	return &usageError{fmt.Errorf(format, a...)}
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+
+func (e *usageError) Unwrap() error { return e.err }
+
+// configError is an error loading or validating the mg config.
+type configError struct {
+	err error
+}
+
+func (e *configError) Error() string { return e.err.Error() }
+
+func (e *configError) Unwrap() error { return e.err }
+
+// reposFailedError is returned by commands that ran against all repos when
+// some of them failed. The failures themselves are already reported by
+// printSummary.
+type reposFailedError struct {
+	Verb   string
+	Failed int
+	Total  int
+}
+
+func (e *reposFailedError) Error() string {
+	return fmt.Sprintf("failed to %s %d/%d repos", e.Verb, e.Failed, e.Total)
+}
+
+func (e *reposFailedError) Unwrap() error { return errReposFailed }
+
+// exitStatusError is returned by mg retry when the command it reran exited
+// with an error, which the command has already reported.
+type exitStatusError struct {
+	Code int
+}
+
+func (e *exitStatusError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code for the error a command returned.
+func ExitCode(err error) int {
+	var (
+		usage  *usageError
+		config *configError
+		status *exitStatusError
+	)
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &status):
+		return status.Code
+	case errors.Is(err, errCancelled), errors.Is(err, context.Canceled):
+		return ExitCancelled
+	case errors.As(err, &usage), errors.As(err, &config):
+		return ExitUsage
+	default:
+		return ExitFailed
+	}
+}
+
+// Reported reports whether err only says that some repos failed, which the
+// command has already reported along with the failures themselves.
+func Reported(err error) bool {
+	var status *exitStatusError
+	return errors.Is(err, errReposFailed) || errors.As(err, &status)
+}
+
+// usageArgs makes the errors of the argument validators of c and all its
+// subcommands usage errors.
+func usageArgs(c *cobra.Command) {
+	if validate := c.Args; validate != nil {
+		c.Args = func(c *cobra.Command, args []string) error {
+			if err := validate(c, args); err != nil {
+				return &usageError{err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range c.Commands() {
+		usageArgs(sub)
+	}
+}
+
+// checkJobs validates the --jobs flag.
+func checkJobs() error {
+	if jobs < 1 {
+		return usageErrorf("jobs must be greater than 0")
+	}
+	return nil
+}
@@ -1,87 +1,55 @@
 package cmd
 
 import (
-	"fmt"
-	"log"
-	"os"
-	"sync"
-
 	git "github.com/go-git/go-git/v5"
 	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
 )
 
 var fetchCmd = &cobra.Command{
 	Use:   "fetch",
 	Short: "fetch all git repos without merging",
-	Run: func(_ *cobra.Command, args []string) {
-		type RepoError struct {
-			Error error
-			Repo  string
-		}
-		if jobs < 1 {
-			log.Println("jobs must be greater than 0")
-			os.Exit(1)
-		}
-		conf := GetConfig()
-		if len(args) > 0 {
-			log.Println("too many arguments")
-			os.Exit(1)
-		}
-		repoChan := make(chan string, len(conf.Repos))
-		var (
-			errs           []RepoError
-			alreadyFetched int
-			mutex          sync.Mutex
-			wg             sync.WaitGroup
-		)
-		wg.Add(len(conf.Repos))
-		for i := 0; i < jobs; i++ {
-			go func() {
-				for repo := range repoChan {
-					log.Printf("attempting fetch: %s\n", repo)
-					r, err := git.PlainOpenWithOptions(repo, &git.PlainOpenOptions{DetectDotGit: true})
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						log.Printf("fetch failed for %s: %v\n", repo, err)
-						wg.Done()
-						continue
-					}
-					err = r.Fetch(&git.FetchOptions{})
-					if err == git.NoErrAlreadyUpToDate {
-						mutex.Lock()
-						alreadyFetched++
-						mutex.Unlock()
-						fmt.Printf("repo %s: already up to date\n", repo)
-						wg.Done()
-						continue
-					} else if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						log.Printf("fetch failed for %s: %v\n", repo, err)
-						wg.Done()
-						continue
-					}
-					fmt.Printf("successfully fetched %s\n", repo)
-					wg.Done()
-				}
-			}()
-		}
-		for _, repo := range conf.Repos {
-			repoChan <- repo.Path
+	Long: `fetch all git repos without merging.
+
+--dry-run lists the refs on origin instead and shows the remote-tracking
+branches a fetch would update.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if err := checkJobs(); err != nil {
+			return err
 		}
-		close(repoChan)
-		wg.Wait()
-		for _, err := range errs {
-			log.Printf("error fetching %s: %s\n", err.Repo, err.Error)
+		conf, err := GetConfig()
+		if err != nil {
+			return err
 		}
-		lenErrs := len(errs)
-		fmt.Println()
-		fmt.Printf("successfully fetched %d/%d repos\n", len(conf.Repos)-lenErrs, len(conf.Repos))
-		fmt.Printf("%d repos already up to date\n", alreadyFetched)
-		fmt.Printf("failed to fetch %d/%d repos\n", lenErrs, len(conf.Repos))
+		results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+			if !dryRun {
+				repoLogf(repo.Path, "attempting fetch: %s\n", repo.Path)
+			}
+			r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			auth, err := remoteAuth(r, git.DefaultRemoteName)
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			if dryRun {
+				return fetchPlan(r, repo.Path)
+			}
+			setPhase(repo.Path, "fetching")
+			err = r.FetchContext(cmd.Context(), &git.FetchOptions{Auth: auth, Progress: sideband(repo.Path)})
+			if err == git.NoErrAlreadyUpToDate {
+				repoPrintf(repo.Path, "repo %s: already up to date\n", repo.Path)
+				return repoResult{Skipped: true}
+			} else if err != nil {
+				return repoResult{Err: err}
+			}
+			repoPrintf(repo.Path, "successfully fetched %s\n", repo.Path)
+			return repoResult{}
+		})
+		return printSummary(results, dryRunSummary(summary{Verb: "fetch", Past: "fetched", Skipped: "already up to date"}))
 	},
 }
 
@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
+)
+
+// goModule is a Go module found inside a registered repo. Use is set for
+// modules that are part of the workspace.
+type goModule struct {
+	Dir string
+	Mod parse.GoMod
+	Use bool
+}
+
+var (
+	goworkOutput  string
+	goworkReplace bool
+	goworkCmd     = &cobra.Command{
+		Use:   "gowork [repo...]",
+		Short: "write a go.work file using the Go modules in all repos",
+		Long: `write a go.work file using the Go modules in all repos.
+
+Every repo is scanned for go.mod files, including nested modules, and a use
+directive is written for each one. Given repo paths, only the modules in
+those repos are used. With --replace, the modules in the other registered
+repos are written as replace directives instead, so the used modules build
+against them without them being part of the workspace. The go tool does not
+allow replacing modules that are used.`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			out, err := filepath.Abs(goworkOutput)
+			if err != nil {
+				return err
+			}
+			if info, err := os.Stat(out); err == nil && info.IsDir() {
+				out = filepath.Join(out, "go.work")
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			used, err := goworkRepos(conf.Repos, args)
+			if err != nil {
+				return err
+			}
+			var (
+				mutex   sync.Mutex
+				modules []goModule
+			)
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				found, err := findGoModules(repo.Path)
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if len(found) == 0 {
+					return repoResult{Skipped: true}
+				}
+				for i := range found {
+					found[i].Use = used[repo.Path]
+				}
+				mutex.Lock()
+				modules = append(modules, found...)
+				mutex.Unlock()
+				return repoResult{}
+			})
+			for _, res := range results {
+				if res.Err != nil {
+					log.Printf("error scanning %s: %s\n", res.Repo, res.Err)
+				}
+			}
+			if countUsed(modules) == 0 {
+				if err := resultsError(results, "scan"); err != nil {
+					return err
+				}
+				return errors.New("no Go modules found")
+			}
+			sort.Slice(modules, func(i, j int) bool {
+				return modules[i].Dir < modules[j].Dir
+			})
+
+			b, err := goWorkFile(modules, filepath.Dir(out), goworkReplace)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Printf("would write %s with %d modules:\n\n%s", out, countUsed(modules), b)
+				return resultsError(results, "scan")
+			}
+			if err := os.WriteFile(out, b, 0o644); err != nil {
+				return err
+			}
+			fmt.Printf("wrote %s with %d modules\n", out, countUsed(modules))
+			return resultsError(results, "scan")
+		},
+	}
+)
+
+// findGoModules walks root looking for go.mod files. Vendor and testdata
+// directories, hidden directories and nested git repos are skipped.
+func findGoModules(root string) ([]goModule, error) {
+	modules := []goModule{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == root {
+				return nil
+			}
+			name := d.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		mod, err := parse.ParseGoMod(b)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		modules = append(modules, goModule{Dir: filepath.Dir(path), Mod: mod})
+		return nil
+	})
+	return modules, err
+}
+
+// goworkRepos returns the paths of the repos whose modules are used, those
+// at paths or all repos without any.
+func goworkRepos(repos []parse.Repo, paths []string) (map[string]bool, error) {
+	used := map[string]bool{}
+	registered := map[string]bool{}
+	for _, repo := range repos {
+		registered[repo.Path] = true
+		if len(paths) == 0 {
+			used[repo.Path] = true
+		}
+	}
+	for _, path := range paths {
+		abs, err := filepath.Abs(expandHome(path))
+		if err != nil {
+			return nil, err
+		}
+		if !registered[abs] {
+			return nil, usageErrorf("%s is not a registered repo", path)
+		}
+		used[abs] = true
+	}
+	return used, nil
+}
+
+// countUsed returns the number of modules used in the workspace.
+func countUsed(modules []goModule) int {
+	n := 0
+	for _, m := range modules {
+		if m.Use {
+			n++
+		}
+	}
+	return n
+}
+
+// goWorkFile renders a go.work file in dir for modules, using the newest go
+// version any of the used ones requires. With replace, modules that are not
+// used are replaced with their local copy.
+func goWorkFile(modules []goModule, dir string, replace bool) ([]byte, error) {
+	goVersion := ""
+	seen := map[string]string{}
+	var sb strings.Builder
+	uses := []string{}
+	replaces := []string{}
+	// used modules first, so a module both used and provided elsewhere is
+	// never replaced
+	sorted := append([]goModule(nil), modules...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Use && !sorted[j].Use })
+	for _, m := range sorted {
+		if !m.Use && !replace {
+			continue
+		}
+		rel, err := filepath.Rel(dir, m.Dir)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		if !strings.HasPrefix(rel, ".") && !filepath.IsAbs(rel) {
+			rel = "./" + rel
+		}
+		if prev, ok := seen[m.Mod.Module]; ok {
+			log.Printf("module %s is provided by both %s and %s, using the first\n", m.Mod.Module, prev, m.Dir)
+			continue
+		}
+		seen[m.Mod.Module] = m.Dir
+		if !m.Use {
+			replaces = append(replaces, fmt.Sprintf("%s => %s", m.Mod.Module, rel))
+			continue
+		}
+		if compareGoVersions(m.Mod.Go, goVersion) > 0 {
+			goVersion = m.Mod.Go
+		}
+		uses = append(uses, rel)
+	}
+	if goVersion != "" {
+		fmt.Fprintf(&sb, "go %s\n\n", goVersion)
+	}
+	sb.WriteString("use (\n")
+	for _, use := range uses {
+		fmt.Fprintf(&sb, "\t%s\n", use)
+	}
+	sb.WriteString(")\n")
+	if len(replaces) > 0 {
+		sb.WriteString("\nreplace (\n")
+		for _, r := range replaces {
+			fmt.Fprintf(&sb, "\t%s\n", r)
+		}
+		sb.WriteString(")\n")
+	}
+	return []byte(sb.String()), nil
+}
+
+// compareGoVersions compares two go directive versions such as 1.22 and
+// 1.22.3, returning -1, 0 or 1. An empty version sorts first.
+func compareGoVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		} else {
+			x = -1
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		} else {
+			y = -1
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+func init() {
+	RootCmd.AddCommand(goworkCmd)
+	goworkCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	goworkCmd.Flags().StringVarP(&goworkOutput, "output", "o", "go.work", "file or directory to write the go.work file to")
+	goworkCmd.Flags().BoolVar(&goworkReplace, "replace", false, "write replace directives for the modules in repos that are not used")
+}
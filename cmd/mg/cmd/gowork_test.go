@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/taigrr/mg/parse"
+)
+
+// writeTestModule writes a go.mod for module to dir and returns it as found
+// by findGoModules.
+func writeTestModule(t *testing.T, dir, module string, requires ...string) goModule {
+	t.Helper()
+	gomod := "module " + module + "\n\ngo 1.21\n"
+	for _, req := range requires {
+		gomod += "\nrequire " + req + " v1.0.0\n"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mod, err := parse.ParseGoMod([]byte(gomod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return goModule{Dir: dir, Mod: mod}
+}
+
+// goListModules runs go list -m with args and the go.work file in dir.
+func goListModules(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	c := exec.Command("go", append([]string{"list", "-m"}, args...)...)
+	c.Dir = dir
+	c.Env = append(os.Environ(), "GOWORK="+filepath.Join(dir, "go.work"), "GOPROXY=off", "GOFLAGS=", "GOTOOLCHAIN=local")
+	out, err := c.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go list -m %s failed: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func TestGoWorkFile(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	dir := t.TempDir()
+	a := writeTestModule(t, filepath.Join(dir, "a"), "example.com/a", "example.com/b")
+	b := writeTestModule(t, filepath.Join(dir, "b"), "example.com/b")
+
+	t.Run("all used", func(t *testing.T) {
+		a.Use, b.Use = true, true
+		work, err := goWorkFile([]goModule{a, b}, dir, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(work), "replace") {
+			t.Errorf("expected no replaces for used modules, got\n%s", work)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "go.work"), work, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out := goListModules(t, dir)
+		if !strings.Contains(out, "example.com/a") || !strings.Contains(out, "example.com/b") {
+			t.Errorf("expected both modules in the workspace, got\n%s", out)
+		}
+	})
+
+	t.Run("replace unused", func(t *testing.T) {
+		a.Use, b.Use = true, false
+		work, err := goWorkFile([]goModule{a, b}, dir, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "go.work"), work, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out := goListModules(t, dir, "all")
+		if !strings.Contains(out, "example.com/b v1.0.0 => ./b") {
+			t.Errorf("expected example.com/b to be replaced, got\n%s", out)
+		}
+	})
+}
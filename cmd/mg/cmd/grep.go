@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
+)
+
+type grepMatch struct {
+	File string
+	Line int
+	Text string
+}
+
+var (
+	grepIgnoreCase bool
+	grepPaths      []string
+	grepRef        string
+	grepCmd        = &cobra.Command{
+		Use:   "grep <pattern>",
+		Short: "search tracked files across all repos",
+		Long: `search tracked files across all repos.
+
+The pattern is a regular expression. Only files tracked at HEAD (or at --ref)
+are searched, so ignored and untracked files are never matched, and binary
+files and lines longer than 1 MiB are skipped. Matches are printed as
+repo:file:line:text.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			expr := args[0]
+			if grepIgnoreCase {
+				expr = "(?i)" + expr
+			}
+			pattern, err := regexp.Compile(expr)
+			if err != nil {
+				return &usageError{err}
+			}
+			for _, glob := range grepPaths {
+				if _, err := path.Match(glob, ""); err != nil {
+					return usageErrorf("bad path glob %q: %w", glob, err)
+				}
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			var (
+				mutex   sync.Mutex
+				matches = map[string][]grepMatch{}
+			)
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				found, err := grepRepo(r, pattern, grepRef, grepPaths)
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				mutex.Lock()
+				matches[repo.Path] = found
+				mutex.Unlock()
+				return repoResult{}
+			})
+
+			for _, repo := range conf.Repos {
+				for _, m := range matches[repo.Path] {
+					fmt.Printf("%s:%s:%d:%s\n", repo.Path, m.File, m.Line, m.Text)
+				}
+			}
+			failed := 0
+			for _, res := range results {
+				if res.Err != nil {
+					failed++
+					log.Printf("error searching %s: %s\n", res.Repo, res.Err)
+				}
+			}
+			if failed > 0 {
+				fmt.Printf("failed to search %d/%d repos\n", failed, len(conf.Repos))
+			}
+			return resultsError(results, "search")
+		},
+	}
+)
+
+// grepRepo searches every tracked, non-binary file in the tree at ref (or
+// HEAD) for pattern. If globs are given, only files whose path or base name
+// matches one of them are searched.
+func grepRepo(r *git.Repository, pattern *regexp.Regexp, ref string, globs []string) ([]grepMatch, error) {
+	var hash plumbing.Hash
+	if ref == "" {
+		head, err := r.Head()
+		if err != nil {
+			return nil, err
+		}
+		hash = head.Hash()
+	} else {
+		h, err := r.ResolveRevision(plumbing.Revision(ref))
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", ref, err)
+		}
+		hash = *h
+	}
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	matches := []grepMatch{}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if !matchesGlobs(f.Name, globs) {
+			return nil
+		}
+		if binary, err := f.IsBinary(); err != nil || binary {
+			return err
+		}
+		reader, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		br := bufio.NewReader(reader)
+		for line := 1; ; line++ {
+			text, tooLong, err := readLine(br)
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if !tooLong && pattern.MatchString(text) {
+				matches = append(matches, grepMatch{File: f.Name, Line: line, Text: text})
+			}
+		}
+	})
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].File < matches[j].File
+	})
+	return matches, err
+}
+
+// maxGrepLine is the length of the longest line searched. Longer lines,
+// such as minified code, are skipped.
+const maxGrepLine = 1024 * 1024
+
+// readLine reads the next line from br without its line ending, like
+// bufio.ScanLines. A line longer than maxGrepLine is read past and reported
+// as too long instead. It returns io.EOF after the last line.
+func readLine(br *bufio.Reader) (string, bool, error) {
+	var (
+		line    []byte
+		read    int
+		tooLong bool
+	)
+	for {
+		chunk, err := br.ReadSlice('\n')
+		read += len(chunk)
+		if !tooLong {
+			line = append(line, chunk...)
+			if len(bytes.TrimSuffix(line, []byte("\n"))) > maxGrepLine {
+				line, tooLong = nil, true
+			}
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && read > 0:
+		case err != nil:
+			return "", false, err
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		return string(line), tooLong, nil
+	}
+}
+
+// matchesGlobs reports whether name, or its base name, matches any of the
+// globs. An empty list matches everything.
+func matchesGlobs(name string, globs []string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, glob := range globs {
+		target := name
+		if !strings.Contains(glob, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(glob, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	RootCmd.AddCommand(grepCmd)
+	grepCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	grepCmd.Flags().BoolVarP(&grepIgnoreCase, "ignore-case", "i", false, "match case insensitively")
+	grepCmd.Flags().StringSliceVarP(&grepPaths, "path", "p", nil, "only search files matching this glob (repeatable)")
+	grepCmd.Flags().StringVar(&grepRef, "ref", "", "search the tree at this commit, branch or tag instead of HEAD")
+}
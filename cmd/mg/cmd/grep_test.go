@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadLine(t *testing.T) {
+	long := strings.Repeat("x", maxGrepLine+1)
+	input := "first\r\n" + long + "\nthird\n" + strings.Repeat("y", maxGrepLine) + "\nlast"
+	br := bufio.NewReader(strings.NewReader(input))
+	want := []struct {
+		text    string
+		tooLong bool
+	}{
+		{"first", false},
+		{"", true},
+		{"third", false},
+		{strings.Repeat("y", maxGrepLine), false},
+		{"last", false},
+	}
+	for i, w := range want {
+		text, tooLong, err := readLine(br)
+		if err != nil {
+			t.Fatalf("line %d: unexpected error: %v", i+1, err)
+		}
+		if text != w.text || tooLong != w.tooLong {
+			t.Errorf("line %d: expected %.10q (too long %v), got %.10q (too long %v)", i+1, w.text, w.tooLong, text, tooLong)
+		}
+	}
+	if _, _, err := readLine(br); err != io.EOF {
+		t.Errorf("expected io.EOF after the last line, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+var errHookFailed = errors.New("hook failed")
+
+// hookError is returned when a git hook exits with an error, and carries
+// the hook's output so it can be shown with the failed repo.
+type hookError struct {
+	Hook   string
+	Output string
+	Err    error
+}
+
+func (e *hookError) Error() string {
+	msg := fmt.Sprintf("%s %s: %s", e.Hook, errHookFailed, e.Err)
+	if e.Output != "" {
+		msg += "\n" + e.Output
+	}
+	return msg
+}
+
+func (e *hookError) Unwrap() error { return errHookFailed }
+
+// hooks runs the git hooks of a single repo. go-git never runs hooks itself.
+type hooks struct {
+	repo     string
+	dir      string
+	gitDir   string
+	worktree string
+}
+
+// repoHooks finds the hooks of r, the repo at path, in core.hooksPath if it
+// is set and in the hooks directory of the git dir otherwise. Like git, a
+// relative core.hooksPath is relative to the root of the worktree.
+func repoHooks(r *git.Repository, w *git.Worktree, path string) (hooks, error) {
+	h := hooks{repo: path, worktree: w.Filesystem.Root()}
+	h.gitDir = filepath.Join(h.worktree, git.GitDirName)
+	if s, ok := r.Storer.(*filesystem.Storage); ok {
+		h.gitDir = s.Filesystem().Root()
+	}
+	cfg, err := r.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return h, err
+	}
+	h.dir = filepath.Join(h.gitDir, "hooks")
+	if path := cfg.Raw.Section("core").Option("hooksPath"); path != "" {
+		h.dir = expandHome(path)
+		if !filepath.IsAbs(h.dir) {
+			h.dir = filepath.Join(h.worktree, h.dir)
+		}
+	}
+	return h, nil
+}
+
+// find returns the path of the named hook and whether it is an executable
+// file. Hooks that are not executable are ignored, as they are by git.
+func (h hooks) find(name string) (string, bool) {
+	path := filepath.Join(h.dir, name)
+	info, err := os.Stat(path)
+	return path, err == nil && !info.IsDir() && info.Mode()&0o111 != 0
+}
+
+// run runs the named hook from the root of the worktree, if it exists and is
+// executable. Its output is printed once it finishes so the output of hooks
+// running in parallel is not interleaved.
+func (h hooks) run(name string, args ...string) error {
+	path, ok := h.find(name)
+	if !ok {
+		return nil
+	}
+	c := exec.Command(path, args...)
+	c.Dir = h.worktree
+	c.Env = append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(h.gitDir, "index"))
+	out, err := c.CombinedOutput()
+	output := strings.TrimRight(string(out), "\n")
+	if err != nil {
+		return &hookError{Hook: name, Output: output, Err: err}
+	}
+	if output != "" {
+		repoPrintf(h.repo, "repo %s: %s:\n%s\n", h.repo, name, output)
+	}
+	return nil
+}
+
+// commitMsg runs the commit-msg hook on message and returns the message as
+// left by the hook, which may edit it. Like git, the message is passed in
+// COMMIT_EDITMSG in the git dir.
+func (h hooks) commitMsg(message string) (string, error) {
+	if _, ok := h.find("commit-msg"); !ok {
+		return message, nil
+	}
+	file := filepath.Join(h.gitDir, "COMMIT_EDITMSG")
+	if err := os.WriteFile(file, []byte(message), 0o644); err != nil {
+		return "", err
+	}
+	if err := h.run("commit-msg", file); err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return "", &hookError{Hook: "commit-msg", Err: errors.New("left an empty commit message")}
+	}
+	return string(b), nil
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/taigrr/mg/parse"
+)
+
+var (
+	knownHostsMode string
+	knownHostsFile string
+)
+
+var errHostKey = errors.New("host key verification failed")
+
+// hostKeyError is returned when a host's SSH key is unknown or has changed.
+type hostKeyError struct {
+	Host    string
+	File    string
+	Changed bool
+}
+
+func (e *hostKeyError) Error() string {
+	if e.Changed {
+		return fmt.Sprintf("%s: the key of %s has changed since it was recorded in %s, someone may be intercepting the connection", errHostKey, e.Host, e.File)
+	}
+	return fmt.Sprintf("%s: %s is not in %s, add it with ssh-keyscan or rerun with --known-hosts accept-new", errHostKey, e.Host, e.File)
+}
+
+func (e *hostKeyError) Unwrap() error { return errHostKey }
+
+// hostKeyPolicy returns the known hosts settings from the config, overridden
+// by the --known-hosts and --known-hosts-file flags.
+func hostKeyPolicy(configured *parse.KnownHosts) parse.KnownHosts {
+	policy := parse.KnownHosts{}
+	if configured != nil {
+		policy = *configured
+	}
+	if knownHostsMode != "" {
+		policy.Mode = knownHostsMode
+	}
+	if knownHostsFile != "" {
+		policy.File = knownHostsFile
+	}
+	if policy.Mode == "" {
+		policy.Mode = parse.KnownHostsStrict
+	}
+	return policy
+}
+
+// checkKnownHostsMode returns a usage error if --known-hosts is not a
+// known mode.
+func checkKnownHostsMode() error {
+	switch knownHostsMode {
+	case "", parse.KnownHostsStrict, parse.KnownHostsAcceptNew:
+		return nil
+	}
+	return usageErrorf("unknown --known-hosts mode %q, expected %s or %s", knownHostsMode, parse.KnownHostsStrict, parse.KnownHostsAcceptNew)
+}
+
+// knownHostsFiles returns the known_hosts files to check host keys against:
+// the configured file, or like ssh and go-git, those in $SSH_KNOWN_HOSTS or
+// ~/.ssh/known_hosts and /etc/ssh/ssh_known_hosts. New keys are recorded in
+// the first one.
+func knownHostsFiles(policy parse.KnownHosts) ([]string, error) {
+	if policy.File != "" {
+		return []string{expandHome(policy.File)}, nil
+	}
+	if files := filepath.SplitList(os.Getenv("SSH_KNOWN_HOSTS")); len(files) > 0 {
+		return files, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return []string{filepath.Join(home, ".ssh", "known_hosts"), "/etc/ssh/ssh_known_hosts"}, nil
+}
+
+// hostKeyChecker verifies SSH host keys against known_hosts files. In
+// accept-new mode the keys of unknown hosts are appended to the first file.
+type hostKeyChecker struct {
+	mode       string
+	file       string
+	files      string
+	known      ssh.HostKeyCallback
+	algorithms func(hostWithPort string) []string
+	mutex      sync.Mutex
+	accepted   map[string]ssh.PublicKey
+}
+
+func newHostKeyChecker(policy parse.KnownHosts) (*hostKeyChecker, error) {
+	if policy.Mode != parse.KnownHostsStrict && policy.Mode != parse.KnownHostsAcceptNew {
+		return nil, fmt.Errorf("unknown known hosts mode %q, expected %s or %s", policy.Mode, parse.KnownHostsStrict, parse.KnownHostsAcceptNew)
+	}
+	files, err := knownHostsFiles(policy)
+	if err != nil {
+		return nil, err
+	}
+	file := files[0]
+	if policy.Mode == parse.KnownHostsAcceptNew {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(file, nil, 0o600); err != nil {
+				return nil, err
+			}
+		}
+	}
+	existing := []string{}
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			existing = append(existing, f)
+		}
+	}
+	if len(existing) == 0 {
+		return nil, fmt.Errorf("%w: %s does not exist, create it or rerun with --known-hosts accept-new", errHostKey, strings.Join(files, " or "))
+	}
+	db, err := gitssh.NewKnownHostsDb(existing...)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", strings.Join(existing, ", "), err)
+	}
+	return &hostKeyChecker{
+		mode:       policy.Mode,
+		file:       file,
+		files:      strings.Join(existing, ", "),
+		known:      db.HostKeyCallback(),
+		algorithms: db.HostKeyAlgorithms,
+		accepted:   map[string]ssh.PublicKey{},
+	}, nil
+}
+
+// hostKeyAlgorithms returns the key algorithms to ask host for, those of
+// the keys known for it, so the server does not offer a key of another type
+// than the recorded ones. It is empty for unknown hosts.
+func (c *hostKeyChecker) hostKeyAlgorithms(host string, port int) []string {
+	if port == 0 {
+		port = 22
+	}
+	return c.algorithms(net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// check is an ssh.HostKeyCallback. A host is only considered changed when
+// the recorded key of the same type differs; a host known with keys of
+// other types only is treated like an unknown host.
+func (c *hostKeyChecker) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	address := knownhosts.Normalize(hostname)
+	if prev, ok := c.accepted[address]; ok {
+		if bytes.Equal(prev.Marshal(), key.Marshal()) {
+			return nil
+		}
+		return &hostKeyError{Host: hostname, File: c.file, Changed: true}
+	}
+	err := c.known(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+	for _, want := range keyErr.Want {
+		if want.Key.Type() == key.Type() {
+			return &hostKeyError{Host: hostname, File: want.Filename, Changed: true}
+		}
+	}
+	if c.mode != parse.KnownHostsAcceptNew {
+		return &hostKeyError{Host: hostname, File: c.files}
+	}
+	f, err := os.OpenFile(c.file, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, knownhosts.Line([]string{address}, key)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "added %s key for %s to %s\n", key.Type(), address, c.file)
+	c.accepted[address] = key
+	return nil
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&knownHostsMode, "known-hosts", "", "SSH host key checking: strict or accept-new (default strict)")
+	RootCmd.PersistentFlags().StringVar(&knownHostsFile, "known-hosts-file", "", "known_hosts file to check and record SSH host keys in")
+}
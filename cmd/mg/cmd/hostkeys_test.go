@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/taigrr/mg/parse"
+)
+
+func testECDSAKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+func TestHostKeyChecker(t *testing.T) {
+	_, known := testSSHKey(t)
+	_, other := testSSHKey(t)
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(file, []byte(knownhosts.Line([]string{"git.example.com"}, known.PublicKey())+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checker, err := newHostKeyChecker(parse.KnownHosts{Mode: parse.KnownHostsStrict, File: file})
+	if err != nil {
+		t.Fatalf("newHostKeyChecker() unexpected error: %v", err)
+	}
+	if algos := checker.hostKeyAlgorithms("git.example.com", 0); !slices.Contains(algos, ssh.KeyAlgoED25519) {
+		t.Errorf("expected the algorithms of the known key, got %v", algos)
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}
+
+	if err := checker.check("git.example.com:22", addr, known.PublicKey()); err != nil {
+		t.Errorf("expected the known key to be accepted, got %v", err)
+	}
+	var hostErr *hostKeyError
+	err = checker.check("git.example.com:22", addr, other.PublicKey())
+	if !errors.As(err, &hostErr) || !hostErr.Changed {
+		t.Errorf("expected another key of the same type to be a changed key, got %v", err)
+	}
+	err = checker.check("git.example.com:22", addr, testECDSAKey(t))
+	if !errors.As(err, &hostErr) || hostErr.Changed {
+		t.Errorf("expected a key of an unrecorded type to be unknown, got %v", err)
+	}
+}
+
+func TestHostKeyChecker_AcceptNew(t *testing.T) {
+	_, key := testSSHKey(t)
+	file := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+	t.Setenv("SSH_KNOWN_HOSTS", file)
+	checker, err := newHostKeyChecker(parse.KnownHosts{Mode: parse.KnownHostsAcceptNew})
+	if err != nil {
+		t.Fatalf("newHostKeyChecker() unexpected error: %v", err)
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2222}
+	if err := checker.check("[git.example.com]:2222", addr, key.PublicKey()); err != nil {
+		t.Fatalf("expected a new host to be accepted, got %v", err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "[git.example.com]:2222 ssh-ed25519 ") {
+		t.Errorf("expected the key to be recorded in $SSH_KNOWN_HOSTS, got %q", b)
+	}
+}
+
+func TestCheckKnownHostsMode(t *testing.T) {
+	t.Cleanup(func() { knownHostsMode = "" })
+	knownHostsMode = "yolo"
+	var usage *usageError
+	if err := checkKnownHostsMode(); !errors.As(err, &usage) {
+		t.Errorf("expected a usage error for an unknown mode, got %v", err)
+	}
+	knownHostsMode = parse.KnownHostsAcceptNew
+	if err := checkKnownHostsMode(); err != nil {
+		t.Errorf("expected accept-new to be valid, got %v", err)
+	}
+}
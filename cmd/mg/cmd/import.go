@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"io"
-	"log"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -14,48 +13,41 @@ var importCmd = &cobra.Command{
 	Use:   "import <file>",
 	Short: "merge a new mgconfig into the current one",
 	Args:  cobra.ExactArgs(1),
-	Run: func(_ *cobra.Command, args []string) {
-		conf := GetConfig()
+	Long: `merge a new mgconfig into the current one, or - to read it from stdin.
+
+--dry-run shows the repos that would be added without saving the config.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conf, err := GetConfig()
+		if err != nil {
+			return err
+		}
+		var f []byte
 		if args[0] == "-" {
-			f, err := io.ReadAll(os.Stdin)
-			if err != nil {
-				log.Println(err)
-				os.Exit(1)
-			}
-			parsed, err := parse.ParseMGConfig(f)
-			if err != nil {
-				log.Println(err)
-				os.Exit(1)
-			}
-			stats, err := conf.Merge(parsed)
-			if err != nil {
-				log.Println(err)
-				os.Exit(1)
-			}
-			fmt.Println(stats)
+			f, err = io.ReadAll(os.Stdin)
 		} else {
-			f, err := os.ReadFile(args[0])
-			if err != nil {
-				log.Println(err)
-				os.Exit(1)
-			}
-			parsed, err := parse.ParseMGConfig(f)
-			if err != nil {
-				log.Println(err)
-				os.Exit(1)
-			}
-			stats, err := conf.Merge(parsed)
-			if err != nil {
-				log.Println(err)
-				os.Exit(1)
-			}
-			fmt.Println(stats)
+			f, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			return &usageError{err}
 		}
-		err := conf.Save()
+		parsed, err := parse.ParseMGConfig(f)
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			return &usageError{err}
+		}
+		stats, err := conf.Merge(parsed)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			for _, path := range stats.NewPaths {
+				fmt.Printf("would add repo %s\n", path)
+			}
+			fmt.Printf("\nwould add %d new repos\n", len(stats.NewPaths))
+			fmt.Printf("would skip %d duplicate repos\n", stats.Duplicates)
+			return nil
 		}
+		fmt.Println(stats)
+		return conf.Save()
 	},
 }
 
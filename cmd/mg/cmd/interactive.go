@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"charm.land/huh/v2"
+	"charm.land/lipgloss/v2"
+	"github.com/charmbracelet/x/term"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/taigrr/mg/parse"
+)
+
+var (
+	errNoTerminal       = errors.New("--interactive needs a terminal")
+	errSelectionAborted = fmt.Errorf("selection %w", errCancelled)
+)
+
+// candidate is a repo offered in the interactive picker, with a short
+// summary of why it is offered.
+type candidate struct {
+	Repo     parse.Repo
+	Summary  string
+	Selected bool
+}
+
+// pickerSummary dims the status summary shown after each repo.
+var pickerSummary = lipgloss.NewStyle().Faint(true)
+
+// chooseRepos lets the user pick from candidates for --interactive. It
+// returns no repos if there was nothing to choose from or nothing was chosen.
+func chooseRepos(title string, candidates []candidate) ([]parse.Repo, error) {
+	if len(candidates) == 0 {
+		fmt.Println("no repos to choose from")
+		return nil, nil
+	}
+	repos, err := pickRepos(title, candidates)
+	if errors.Is(err, errNoTerminal) {
+		return nil, &usageError{err}
+	} else if err != nil {
+		return nil, err
+	}
+	if len(repos) == 0 {
+		fmt.Println("no repos selected")
+	}
+	return repos, nil
+}
+
+// pickRepos shows candidates as a checklist on the terminal and returns the
+// repos the user selected, in the order they were given.
+func pickRepos(title string, candidates []candidate) ([]parse.Repo, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) || !term.IsTerminal(os.Stderr.Fd()) {
+		return nil, errNoTerminal
+	}
+	options := make([]huh.Option[int], len(candidates))
+	for i, c := range candidates {
+		options[i] = huh.NewOption(c.Repo.Path+"  "+pickerSummary.Render(c.Summary), i).Selected(c.Selected)
+	}
+	var chosen []int
+	_, height, err := term.GetSize(os.Stderr.Fd())
+	if err != nil || height <= 0 {
+		height = 24
+	}
+	field := huh.NewMultiSelect[int]().
+		Title(title).
+		Options(options...).
+		Height(min(len(candidates)+2, max(height-3, 3))).
+		Value(&chosen)
+	err = huh.NewForm(huh.NewGroup(field)).WithOutput(os.Stderr).Run()
+	if errors.Is(err, huh.ErrUserAborted) {
+		return nil, errSelectionAborted
+	} else if err != nil {
+		return nil, err
+	}
+	slices.Sort(chosen)
+	repos := make([]parse.Repo, len(chosen))
+	for i, n := range chosen {
+		repos[i] = candidates[n].Repo
+	}
+	return repos, nil
+}
+
+// commitCandidates returns the repos with changes to tracked files, or all
+// repos if an empty commit is allowed. Repos with only untracked files are
+// left out, as mg commit never adds them.
+func commitCandidates(repos []parse.Repo, allowEmpty bool) []candidate {
+	var candidates []candidate
+	for _, repo := range repos {
+		summary, changed := "", false
+		r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+		if err == nil {
+			var w *git.Worktree
+			if w, err = r.Worktree(); err == nil {
+				var st git.Status
+				if st, err = w.Status(); err == nil {
+					summary, changed = statusSummary(st)
+				}
+			}
+		}
+		if err != nil {
+			// offer broken repos so the error is reported by the command
+			summary, changed = "error: "+err.Error(), true
+		}
+		if changed || allowEmpty {
+			candidates = append(candidates, candidate{Repo: repo, Summary: summary})
+		}
+	}
+	return candidates
+}
+
+// statusSummary describes a worktree status as counts of staged, modified
+// and untracked files, and reports whether any tracked file changed.
+func statusSummary(st git.Status) (string, bool) {
+	staged, modified, untracked := 0, 0, 0
+	for _, s := range st {
+		switch {
+		case s.Staging == git.Untracked:
+			untracked++
+		default:
+			if s.Staging != git.Unmodified {
+				staged++
+			}
+			if s.Worktree != git.Unmodified {
+				modified++
+			}
+		}
+	}
+	var parts []string
+	for _, count := range []struct {
+		n    int
+		name string
+	}{{staged, "staged"}, {modified, "modified"}, {untracked, "untracked"}} {
+		if count.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", count.n, count.name))
+		}
+	}
+	if len(parts) == 0 {
+		return "clean", false
+	}
+	return strings.Join(parts, ", "), staged+modified > 0
+}
+
+// pushCandidates returns the repos with local branches that are ahead of, or
+// missing from, their remote-tracking branch on origin.
+func pushCandidates(repos []parse.Repo) []candidate {
+	var candidates []candidate
+	for _, repo := range repos {
+		summary, err := unpushedSummary(repo.Path)
+		if err != nil {
+			summary = "error: " + err.Error()
+		}
+		if summary != "" {
+			candidates = append(candidates, candidate{Repo: repo, Summary: summary})
+		}
+	}
+	return candidates
+}
+
+// unpushedSummary describes the branches of the repo at path that a push
+// would update, e.g. "main +2, feature new". It is empty if there are none.
+func unpushedSummary(path string) (string, error) {
+	r, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", err
+	}
+	branches, err := r.Branches()
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().Short()
+		tracking, err := r.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, name), true)
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			parts = append(parts, name+" new")
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if tracking.Hash() == ref.Hash() {
+			return nil
+		}
+		ahead, err := commitsAhead(r, ref.Hash(), tracking.Hash())
+		if err != nil {
+			return err
+		}
+		if ahead > 0 {
+			parts = append(parts, fmt.Sprintf("%s +%d", name, ahead))
+		}
+		return nil
+	})
+	return strings.Join(parts, ", "), err
+}
+
+// commitsAhead counts the commits reachable from local but not from remote.
+func commitsAhead(r *git.Repository, local, remote plumbing.Hash) (int, error) {
+	seen := map[plumbing.Hash]bool{}
+	if c, err := r.CommitObject(remote); err == nil {
+		err := object.NewCommitPreorderIter(c, nil, nil).ForEach(func(c *object.Commit) error {
+			seen[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	c, err := r.CommitObject(local)
+	if err != nil {
+		return 0, err
+	}
+	ahead := 0
+	err = object.NewCommitPreorderIter(c, seen, nil).ForEach(func(*object.Commit) error {
+		ahead++
+		return nil
+	})
+	return ahead, err
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
+)
+
+// onlyRepos limits the repos commands run against, set with the hidden
+// --only flag mg retry passes to the command it reruns.
+var onlyRepos []string
+
+// selectRepos returns the repos --only limits a command to, or all of repos
+// without it.
+func selectRepos(repos []parse.Repo) []parse.Repo {
+	if len(onlyRepos) == 0 {
+		return repos
+	}
+	only := map[string]bool{}
+	for _, path := range onlyRepos {
+		only[path] = true
+	}
+	selected := []parse.Repo{}
+	for _, repo := range repos {
+		if only[repo.Path] {
+			selected = append(selected, repo)
+		}
+	}
+	return selected
+}
+
+// retryArgs returns the args of a run to rerun it with, without any --only
+// flags and without --interactive, as the repos to retry are already known.
+func retryArgs(args []string) []string {
+	kept := []string{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--":
+			return append(kept, args[i:]...)
+		case args[i] == "--only":
+			i++
+		case strings.HasPrefix(args[i], "--only="):
+		case args[i] == "--interactive", strings.HasPrefix(args[i], "--interactive="):
+		default:
+			kept = append(kept, args[i])
+		}
+	}
+	return kept
+}
+
+// RecordRun adds the run that just finished with err to the journal. Only
+// runs against repos are recorded, so looking at the journal with mg last
+// does not replace the run being looked at. Failing to record a run does not
+// fail it.
+func RecordRun(err error) {
+	if len(report.Suites) == 0 {
+		return
+	}
+	run := parse.JournalRun{
+		Command:  report.Command,
+		Args:     os.Args[1:],
+		Started:  report.Started,
+		Finished: time.Now(),
+		ExitCode: ExitCode(err),
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if dir, err := os.Getwd(); err == nil {
+		run.Dir = dir
+	}
+	for _, s := range report.Suites {
+		for _, res := range s.Results {
+			repo := parse.JournalRepo{Path: res.Repo, Step: s.Verb, Outcome: parse.OutcomeSucceeded, Duration: res.Duration}
+			switch {
+			case res.Err != nil:
+				repo.Outcome = parse.OutcomeFailed
+				repo.Error = res.Err.Error()
+			case res.Skipped:
+				repo.Outcome = parse.OutcomeSkipped
+			}
+			run.Repos = append(run.Repos, repo)
+		}
+	}
+	path, err := parse.JournalPath()
+	if err == nil {
+		err = parse.AppendJournal(path, run, parse.JournalKeep)
+	}
+	if err != nil {
+		log.Printf("failed to record the run in the journal: %s\n", err)
+	}
+}
+
+// lastRun returns the most recent run in the journal.
+func lastRun() (parse.JournalRun, error) {
+	path, err := parse.JournalPath()
+	if err != nil {
+		return parse.JournalRun{}, err
+	}
+	runs, err := parse.LoadJournal(path)
+	if err != nil {
+		return parse.JournalRun{}, err
+	}
+	if len(runs) == 0 {
+		return parse.JournalRun{}, errors.New("no runs recorded yet")
+	}
+	return runs[len(runs)-1], nil
+}
+
+var (
+	lastCmd = &cobra.Command{
+		Use:   "last",
+		Short: "show the outcome of every repo in the last run",
+		Long: `show the outcome of every repo in the last run.
+
+Every run of mg against repos is recorded in a journal in
+$XDG_STATE_HOME/mg/journal.jsonl, or ~/.local/state/mg/journal.jsonl, which
+keeps the last 50 runs.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			run, err := lastRun()
+			if err != nil {
+				return err
+			}
+			fmt.Println(strings.Join(append([]string{"mg"}, run.Args...), " "))
+			fmt.Printf("started %s in %s, took %s, exited with %d\n",
+				run.Started.Local().Format(time.DateTime), run.Dir,
+				run.Finished.Sub(run.Started).Round(time.Millisecond), run.ExitCode)
+			fmt.Println()
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "REPO\tSTEP\tOUTCOME\tDURATION\tERROR")
+			for _, repo := range run.Repos {
+				// only the first line, hooks add their output to the error
+				msg, _, _ := strings.Cut(repo.Error, "\n")
+				if msg == "" {
+					msg = "-"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", repo.Path, repo.Step, repo.Outcome, repo.Duration.Round(time.Millisecond), msg)
+			}
+			tw.Flush()
+			if failed := run.Failed(); len(failed) > 0 {
+				fmt.Println()
+				fmt.Printf("%d repos failed, run mg retry to rerun the command on them\n", len(failed))
+			}
+			return nil
+		},
+	}
+	retryCmd = &cobra.Command{
+		Use:   "retry",
+		Short: "rerun the last run on the repos that failed in it",
+		Long: `rerun the last run on the repos that failed in it.
+
+The command is run again with the same arguments, except --interactive, from
+the same directory, but only against the repos that failed, including those
+skipped because a dependency failed or because the run was interrupted. With
+--dry-run the command is rerun as a dry run.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			run, err := lastRun()
+			if err != nil {
+				return err
+			}
+			failed := run.Failed()
+			if len(failed) == 0 {
+				fmt.Printf("no repos failed in the last run: mg %s\n", strings.Join(run.Args, " "))
+				return nil
+			}
+			args := retryArgs(run.Args)
+			fmt.Printf("retrying mg %s on %d repos\n", strings.Join(args, " "), len(failed))
+			flags := []string{}
+			for _, path := range failed {
+				flags = append(flags, "--only", path)
+			}
+			if dryRun {
+				flags = append(flags, "--dry-run")
+			}
+			// flags must come before a -- ending them
+			end := slices.Index(args, "--")
+			if end < 0 {
+				end = len(args)
+			}
+			args = slices.Concat(args[:end], flags, args[end:])
+			exe, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			// the command is interrupted along with mg, so mg waits for it
+			// and exits like it did
+			c := exec.Command(exe, args...)
+			c.Dir = run.Dir
+			c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+			err = c.Run()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				if exitErr.ExitCode() < 0 {
+					// killed by a signal
+					return errCancelled
+				}
+				return &exitStatusError{Code: exitErr.ExitCode()}
+			}
+			return err
+		},
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(lastCmd, retryCmd)
+	RootCmd.PersistentFlags().StringArrayVar(&onlyRepos, "only", nil, "only run against the repo at this path (repeatable)")
+	RootCmd.PersistentFlags().MarkHidden("only")
+}
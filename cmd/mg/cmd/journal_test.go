@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRetryArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"push", "--interactive", "-j", "4"}, []string{"push", "-j", "4"}},
+		{[]string{"commit", "--interactive=true", "-m", "msg"}, []string{"commit", "-m", "msg"}},
+		{[]string{"pull", "--only", "/code/a", "--only=/code/b"}, []string{"pull"}},
+		{[]string{"grep", "--", "--interactive"}, []string{"grep", "--", "--interactive"}},
+	}
+	for _, tt := range tests {
+		if got := retryArgs(tt.args); !slices.Equal(got, tt.want) {
+			t.Errorf("retryArgs(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
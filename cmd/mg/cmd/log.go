@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
+)
+
+type logEntry struct {
+	Repo    string    `json:"repo"`
+	Path    string    `json:"path"`
+	Hash    string    `json:"hash"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+}
+
+var (
+	logSince   string
+	logUntil   string
+	logAuthor  string
+	logGrep    string
+	logLimit   int
+	logBranch  string
+	logOneline bool
+	logJSON    bool
+	logCmd     = &cobra.Command{
+		Use:   "log",
+		Short: "show a single timeline of commits across all repos",
+		Long: `show a single timeline of commits across all repos.
+
+Commits from every repo are merged and sorted by commit time, newest first.
+--since and --until accept dates (2006-01-02), RFC 3339 timestamps, or ages
+such as 36h, 7d or 2w.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			if logOneline && logJSON {
+				return usageErrorf("--oneline and --json cannot be used together")
+			}
+			opts := git.LogOptions{Order: git.LogOrderCommitterTime}
+			for _, t := range []struct {
+				value string
+				dest  **time.Time
+			}{{logSince, &opts.Since}, {logUntil, &opts.Until}} {
+				if t.value == "" {
+					continue
+				}
+				parsed, err := parseTime(t.value)
+				if err != nil {
+					return &usageError{err}
+				}
+				*t.dest = &parsed
+			}
+			var author, grep *regexp.Regexp
+			var err error
+			if logAuthor != "" {
+				if author, err = regexp.Compile("(?i)" + logAuthor); err != nil {
+					return &usageError{err}
+				}
+			}
+			if logGrep != "" {
+				if grep, err = regexp.Compile(logGrep); err != nil {
+					return &usageError{err}
+				}
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			var (
+				mutex   sync.Mutex
+				entries []logEntry
+			)
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				repoOpts := opts
+				if logBranch != "" {
+					ref, err := r.Reference(referenceName(logBranch), true)
+					if errors.Is(err, plumbing.ErrReferenceNotFound) {
+						return repoResult{Skipped: true}
+					} else if err != nil {
+						return repoResult{Err: err}
+					}
+					repoOpts.From = ref.Hash()
+				}
+				iter, err := r.Log(&repoOpts)
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				found := []logEntry{}
+				err = iter.ForEach(func(c *object.Commit) error {
+					if author != nil && !author.MatchString(c.Author.Name+" <"+c.Author.Email+">") {
+						return nil
+					}
+					if grep != nil && !grep.MatchString(c.Message) {
+						return nil
+					}
+					found = append(found, logEntry{
+						Repo:    filepath.Base(repo.Path),
+						Path:    repo.Path,
+						Hash:    c.Hash.String(),
+						Author:  c.Author.Name,
+						Email:   c.Author.Email,
+						Date:    c.Committer.When,
+						Message: c.Message,
+					})
+					// only the newest n commits of any repo can make the cut
+					if logLimit > 0 && len(found) >= logLimit {
+						return storer.ErrStop
+					}
+					return nil
+				})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				mutex.Lock()
+				entries = append(entries, found...)
+				mutex.Unlock()
+				return repoResult{}
+			})
+
+			sort.SliceStable(entries, func(i, j int) bool {
+				return entries[i].Date.After(entries[j].Date)
+			})
+			if logLimit > 0 && len(entries) > logLimit {
+				entries = entries[:logLimit]
+			}
+			switch {
+			case logJSON:
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if entries == nil {
+					entries = []logEntry{}
+				}
+				if err := enc.Encode(entries); err != nil {
+					return err
+				}
+			case logOneline:
+				for _, e := range entries {
+					subject, _, _ := strings.Cut(e.Message, "\n")
+					fmt.Printf("%s %s %s\n", e.Repo, e.Hash[:7], subject)
+				}
+			default:
+				for _, e := range entries {
+					fmt.Printf("%s: commit %s\n", e.Repo, e.Hash)
+					fmt.Printf("Author: %s <%s>\n", e.Author, e.Email)
+					fmt.Printf("Date:   %s\n\n", e.Date.Format("Mon Jan 2 15:04:05 2006 -0700"))
+					for _, line := range strings.Split(strings.TrimRight(e.Message, "\n"), "\n") {
+						fmt.Printf("    %s\n", line)
+					}
+					fmt.Println()
+				}
+			}
+			for _, res := range results {
+				if res.Err != nil {
+					log.Printf("error reading %s: %s\n", res.Repo, res.Err)
+				}
+			}
+			return resultsError(results, "read")
+		},
+	}
+)
+
+// parseTime parses an absolute date or timestamp, or an age relative to now
+// such as 36h, 7d or 2w.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, errors.New("empty time")
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if unit, ok := units[s[len(s)-1]]; ok && len(s) > 1 {
+		if n, err := strconv.Atoi(s[:len(s)-1]); err == nil {
+			return time.Now().Add(-time.Duration(n) * unit), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse time %q", s)
+}
+
+func init() {
+	RootCmd.AddCommand(logCmd)
+	logCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	logCmd.Flags().StringVar(&logSince, "since", "", "only show commits newer than this date or age")
+	logCmd.Flags().StringVar(&logUntil, "until", "", "only show commits older than this date or age")
+	logCmd.Flags().StringVar(&logAuthor, "author", "", "only show commits whose author matches this regexp")
+	logCmd.Flags().StringVar(&logGrep, "grep", "", "only show commits whose message matches this regexp")
+	logCmd.Flags().IntVarP(&logLimit, "max-count", "n", 0, "limit the number of commits shown")
+	logCmd.Flags().StringVar(&logBranch, "branch", "", "show history of this branch or ref instead of HEAD")
+	logCmd.Flags().BoolVar(&logOneline, "oneline", false, "show one line per commit")
+	logCmd.Flags().BoolVar(&logJSON, "json", false, "print commits as JSON")
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	git "github.com/go-git/go-git/v5"
+
+	"github.com/taigrr/mg/parse"
+)
+
+// messageData is the data commit message templates are executed with.
+type messageData struct {
+	Path   string
+	Name   string
+	Remote string
+	Branch string
+	Tags   []string
+}
+
+// RepoName is the same as Name.
+func (d messageData) RepoName() string { return d.Name }
+
+// messageFuncs are the functions available to commit message templates in
+// addition to the text/template builtins.
+var messageFuncs = template.FuncMap{
+	"join": func(sep string, s []string) string { return strings.Join(s, sep) },
+}
+
+// parseMessage parses a commit message as a text/template. Unknown fields
+// are an error rather than rendering as "<no value>".
+func parseMessage(message string) (*template.Template, error) {
+	tmpl, err := template.New("message").Option("missingkey=error").Funcs(messageFuncs).Parse(message)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderMessage executes tmpl for repo. The branch is the one configured for
+// the repo, or the checked out branch if none is.
+func renderMessage(tmpl *template.Template, repo parse.Repo, r *git.Repository) (string, error) {
+	data := messageData{
+		Path:   repo.Path,
+		Name:   filepath.Base(repo.Path),
+		Remote: repo.Remote,
+		Branch: repo.Branch,
+		Tags:   repo.Tags,
+	}
+	if data.Branch == "" {
+		if head, err := r.Head(); err == nil && head.Name().IsBranch() {
+			data.Branch = head.Name().Short()
+		}
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("rendering message template: %w", err)
+	}
+	return b.String(), nil
+}
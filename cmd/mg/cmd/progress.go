@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"charm.land/lipgloss/v2"
+	"github.com/charmbracelet/x/term"
+)
+
+var noProgress bool
+
+// progress is the live view of the running forEachRepo, or nil when output
+// is not a terminal or no command is running.
+var progress *progressView
+
+var (
+	spinnerFrames  = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+	progressSpin   = lipgloss.NewStyle().Foreground(lipgloss.Color("5"))
+	progressPhase  = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	progressDetail = lipgloss.NewStyle().Faint(true)
+	progressDone   = lipgloss.NewStyle().Foreground(lipgloss.Color("5"))
+	progressTodo   = lipgloss.NewStyle().Faint(true)
+)
+
+// progressView draws a line for every repo in flight and an overall progress
+// bar at the bottom of the terminal. While it runs, stdout and the log are
+// redirected through it, so the lines printed by repos scroll above the
+// view instead of being torn apart by redraws.
+type progressView struct {
+	mutex   sync.Mutex
+	out     *os.File
+	total   int
+	done    int
+	start   time.Time
+	repos   []*repoProgress
+	drawn   int
+	frame   int
+	paused  bool
+	stop    chan struct{}
+	stopped chan struct{}
+	pipe    *os.File
+	drained chan struct{}
+	stdout  *os.File
+	logOut  io.Writer
+}
+
+// repoProgress is the state of a single repo in flight.
+type repoProgress struct {
+	path   string
+	phase  string
+	detail string
+}
+
+// startProgress starts the live view for total repos if stdout and stderr
+// are terminals, and returns nil otherwise, in which case output is printed
+// as plain lines as it happens.
+func startProgress(total int) *progressView {
+	if noProgress || progress != nil || !term.IsTerminal(os.Stdout.Fd()) || !term.IsTerminal(os.Stderr.Fd()) {
+		return nil
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil
+	}
+	v := &progressView{
+		out:     os.Stderr,
+		total:   total,
+		start:   time.Now(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		pipe:    w,
+		drained: make(chan struct{}),
+		stdout:  os.Stdout,
+		logOut:  log.Writer(),
+	}
+	os.Stdout = w
+	log.SetOutput(w)
+	progress = v
+
+	go func() {
+		defer close(v.drained)
+		// read lines of any length, stopping early would leave writers
+		// blocked on the full pipe
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				v.println(strings.TrimSuffix(line, "\n"))
+			}
+			if err != nil {
+				break
+			}
+		}
+		r.Close()
+	}()
+	go func() {
+		defer close(v.stopped)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-v.stop:
+				return
+			case <-ticker.C:
+				v.mutex.Lock()
+				v.frame++
+				v.redraw()
+				v.mutex.Unlock()
+			}
+		}
+	}()
+	return v
+}
+
+// finish stops the view, prints any remaining output and restores stdout
+// and the log.
+func (v *progressView) finish() {
+	if v == nil {
+		return
+	}
+	close(v.stop)
+	<-v.stopped
+	os.Stdout = v.stdout
+	log.SetOutput(v.logOut)
+	v.pipe.Close()
+	<-v.drained
+	v.mutex.Lock()
+	v.clear()
+	v.mutex.Unlock()
+	progress = nil
+}
+
+// begin adds the repo at path to the repos in flight.
+func (v *progressView) begin(path string) {
+	if v == nil {
+		return
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.repos = append(v.repos, &repoProgress{path: path})
+	v.redraw()
+}
+
+// end removes the repo at path from the repos in flight and counts it as
+// done. Repos that never began, such as those skipped because a dependency
+// failed, are counted as well.
+func (v *progressView) end(path string) {
+	if v == nil {
+		return
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for i, rp := range v.repos {
+		if rp.path == path {
+			v.repos = append(v.repos[:i], v.repos[i+1:]...)
+			break
+		}
+	}
+	v.done++
+	v.redraw()
+}
+
+// update changes the phase or the transfer detail of the repo at path.
+func (v *progressView) update(path string, fn func(*repoProgress)) {
+	if v == nil {
+		return
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for _, rp := range v.repos {
+		if rp.path == path {
+			fn(rp)
+		}
+	}
+}
+
+// println prints a line of output above the view.
+func (v *progressView) println(line string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.clear()
+	fmt.Fprintln(v.out, line)
+	v.redraw()
+}
+
+// pause hides the view, e.g. while prompting for a passphrase, until the
+// returned function is called.
+func (v *progressView) pause() func() {
+	if v == nil {
+		return func() {}
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.clear()
+	v.paused = true
+	return func() {
+		v.mutex.Lock()
+		defer v.mutex.Unlock()
+		v.paused = false
+		v.redraw()
+	}
+}
+
+// clear erases the drawn view. The cursor is left where the view started.
+func (v *progressView) clear() {
+	if v.drawn > 0 {
+		fmt.Fprintf(v.out, "\x1b[%dA\r\x1b[J", v.drawn)
+		v.drawn = 0
+	}
+}
+
+// redraw replaces the drawn view with the current state. Lines are cut to
+// the width of the terminal so they never wrap, and repos that do not fit
+// on it are counted instead of shown.
+func (v *progressView) redraw() {
+	if v.paused {
+		return
+	}
+	width, height, err := term.GetSize(v.out.Fd())
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	line := lipgloss.NewStyle().MaxWidth(width)
+	rows := max(height/2, 1)
+	var lines []string
+	spinner := progressSpin.Render(spinnerFrames[v.frame%len(spinnerFrames)])
+	for i, rp := range v.repos {
+		if i == rows {
+			lines = append(lines, progressDetail.Render(fmt.Sprintf("  and %d more", len(v.repos)-rows)))
+			break
+		}
+		l := spinner + " " + rp.path
+		if rp.phase != "" {
+			l += " " + progressPhase.Render(rp.phase)
+		}
+		if rp.detail != "" {
+			l += " " + progressDetail.Render(rp.detail)
+		}
+		lines = append(lines, line.Render(l))
+	}
+	lines = append(lines, line.Render(v.bar(min(30, max(width-40, 10)))))
+
+	v.clear()
+	lipgloss.Fprint(v.out, strings.Join(lines, "\n")+"\n")
+	v.drawn = len(lines)
+}
+
+// bar renders the overall progress bar with the number of repos done and
+// the estimated time until all are.
+func (v *progressView) bar(width int) string {
+	filled := 0
+	if v.total > 0 {
+		filled = width * v.done / v.total
+	}
+	eta := "ETA --"
+	if v.done > 0 && v.done < v.total {
+		elapsed := time.Since(v.start)
+		remaining := elapsed / time.Duration(v.done) * time.Duration(v.total-v.done)
+		eta = "ETA " + remaining.Round(time.Second).String()
+	} else if v.done == v.total {
+		eta = "done"
+	}
+	return fmt.Sprintf("%s%s %d/%d repos  %s",
+		progressDone.Render(strings.Repeat("█", filled)),
+		progressTodo.Render(strings.Repeat("░", width-filled)),
+		v.done, v.total, eta)
+}
+
+// setPhase shows what is being done to the repo at path, e.g. "fetching".
+// It does nothing without a live view.
+func setPhase(path, phase string) {
+	progress.update(path, func(rp *repoProgress) {
+		rp.phase = phase
+		rp.detail = ""
+	})
+}
+
+// sideband returns a writer for go-git's Progress options that shows the
+// remote's progress messages, such as "Receiving objects: 45% (9/20)", on
+// the line of the repo at path. It is nil without a live view.
+func sideband(path string) io.Writer {
+	if progress == nil {
+		return nil
+	}
+	return sidebandWriter{view: progress, path: path}
+}
+
+type sidebandWriter struct {
+	view *progressView
+	path string
+}
+
+// Write keeps the last message, as messages are updated in place with \r.
+func (w sidebandWriter) Write(p []byte) (int, error) {
+	messages := strings.FieldsFunc(string(p), func(r rune) bool { return r == '\r' || r == '\n' })
+	for i := len(messages) - 1; i >= 0; i-- {
+		if message := strings.TrimSpace(messages[i]); message != "" {
+			w.view.update(w.path, func(rp *repoProgress) { rp.detail = message })
+			break
+		}
+	}
+	return len(p), nil
+}
+
+func init() {
+	RootCmd.PersistentFlags().BoolVar(&noProgress, "no-progress", false, "print plain lines instead of the live progress view")
+}
@@ -2,12 +2,12 @@ package cmd
 
 import (
 	"fmt"
-	"log"
-	"os"
-	"sync"
 
 	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
 )
 
 // pullCmd represents the pull command
@@ -16,83 +16,62 @@ var (
 	pullCmd = &cobra.Command{
 		Use:   "pull",
 		Short: "update all git repos specified in config",
-		Run: func(_ *cobra.Command, args []string) {
-			type RepoError struct {
-				Error error
-				Repo  string
-			}
-			if jobs < 1 {
-				log.Println("jobs must be greater than 0")
-				os.Exit(1)
+		Args:  cobra.NoArgs,
+		Long: `update all git repos specified in config.
+
+--dry-run lists the refs on origin instead and shows the remote-tracking
+branches and the HEAD a pull would update.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkJobs(); err != nil {
+				return err
 			}
-			conf := GetConfig()
-			if len(args) > 0 {
-				log.Println("too many arguments")
-				os.Exit(1)
+			conf, err := GetConfig()
+			if err != nil {
+				return err
 			}
-			repoChan := make(chan string, len(conf.Repos))
-			errs := []RepoError{}
-			alreadyUpToDate := 0
-			mutex := sync.Mutex{}
-			wg := sync.WaitGroup{}
-			wg.Add(len(conf.Repos))
-			for i := 0; i < jobs; i++ {
-				go func() {
-					for repo := range repoChan {
-						log.Printf("attempting pull: %s\n", repo)
-						r, err := git.PlainOpenWithOptions(repo, &(git.PlainOpenOptions{DetectDotGit: true}))
-						if err != nil {
-							mutex.Lock()
-							errs = append(errs, RepoError{Error: err, Repo: repo})
-							mutex.Unlock()
-							log.Printf("pull failed for %s: %v\n", repo, err)
-							wg.Done()
-							continue
-						}
-						w, err := r.Worktree()
-						if err != nil {
-							mutex.Lock()
-							errs = append(errs, RepoError{Error: err, Repo: repo})
-							mutex.Unlock()
-							log.Printf("pull failed for %s: %v\n", repo, err)
-							wg.Done()
-							continue
-						}
-						err = w.Pull(&git.PullOptions{})
-						if err == git.NoErrAlreadyUpToDate {
-							mutex.Lock()
-							alreadyUpToDate++
-							mutex.Unlock()
-							fmt.Printf("repo %s: already up to date\n", repo)
-							wg.Done()
-							continue
-						} else if err != nil {
-							mutex.Lock()
-							errs = append(errs, RepoError{Error: err, Repo: repo})
-							mutex.Unlock()
-							log.Printf("pull failed for %s: %v\n", repo, err)
-							wg.Done()
-							continue
-						} else {
-							fmt.Printf("successfully pulled %s\n", w.Filesystem.Root())
-						}
-						wg.Done()
+			results := forEachRepoInOrder(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				if !dryRun {
+					repoLogf(repo.Path, "attempting pull: %s\n", repo.Path)
+				}
+				r, err := git.PlainOpenWithOptions(repo.Path, &(git.PlainOpenOptions{DetectDotGit: true}))
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				w, err := r.Worktree()
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				auth, err := remoteAuth(r, git.DefaultRemoteName)
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				opts := &git.PullOptions{Auth: auth, Progress: sideband(repo.Path)}
+				if repo.Branch != "" {
+					// only pull the pinned branch, and only into itself
+					opts.ReferenceName = plumbing.NewBranchReferenceName(repo.Branch)
+					head, err := r.Head()
+					if err != nil {
+						return repoResult{Err: err}
 					}
-				}()
-			}
-			for _, repo := range conf.Repos {
-				repoChan <- repo.Path
-			}
-			close(repoChan)
-			wg.Wait()
-			for _, err := range errs {
-				log.Printf("error pulling %s: %s\n", err.Repo, err.Error)
-			}
-			lenErrs := len(errs)
-			fmt.Println()
-			fmt.Printf("successfully pulled %d/%d repos\n", len(conf.Repos)-lenErrs, len(conf.Repos))
-			fmt.Printf("%d repos already up to date\n", alreadyUpToDate)
-			fmt.Printf("failed to pull %d/%d repos\n", lenErrs, len(conf.Repos))
+					if head.Name() != opts.ReferenceName {
+						return repoResult{Err: fmt.Errorf("on %s but pinned to %s", head.Name().Short(), repo.Branch)}
+					}
+				}
+				if dryRun {
+					return pullPlan(r, repo.Path, opts.ReferenceName)
+				}
+				setPhase(repo.Path, "pulling")
+				err = w.PullContext(cmd.Context(), opts)
+				if err == git.NoErrAlreadyUpToDate {
+					repoPrintf(repo.Path, "repo %s: already up to date\n", repo.Path)
+					return repoResult{Skipped: true}
+				} else if err != nil {
+					return repoResult{Err: err}
+				}
+				repoPrintf(repo.Path, "successfully pulled %s\n", w.Filesystem.Root())
+				return repoResult{}
+			})
+			return printSummary(results, dryRunSummary(summary{Verb: "pull", Past: "pulled", Skipped: "already up to date"}))
 		},
 	}
 )
@@ -1,95 +1,76 @@
 package cmd
 
 import (
-	"fmt"
-	"log"
-	"os"
-	"sync"
-
 	git "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
 )
 
+var pushInteractive bool
+
 // pushCmd represents the push command
 var pushCmd = &cobra.Command{
 	Use:   "push",
 	Short: "push all git repos",
-	Run: func(_ *cobra.Command, args []string) {
-		type RepoError struct {
-			Error error
-			Repo  string
-		}
-		if jobs < 1 {
-			log.Println("jobs must be greater than 0")
-			os.Exit(1)
-		}
-		conf := GetConfig()
-		if len(args) > 0 {
-			log.Println("too many arguments")
-			os.Exit(1)
-		}
-		repoChan := make(chan string, len(conf.Repos))
-		var (
-			errs            []RepoError
-			alreadyUpToDate int
-			mutex           sync.Mutex
-			wg              sync.WaitGroup
-		)
-		wg.Add(len(conf.Repos))
-		for i := 0; i < jobs; i++ {
-			go func() {
-				for repo := range repoChan {
-					log.Printf("attempting push: %s\n", repo)
-					r, err := git.PlainOpenWithOptions(repo, &git.PlainOpenOptions{DetectDotGit: true})
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						log.Printf("push failed for %s: %v\n", repo, err)
-						wg.Done()
-						continue
-					}
-					err = r.Push(&git.PushOptions{
-						RefSpecs: []config.RefSpec{"refs/heads/*:refs/heads/*"},
-					})
-					if err == git.NoErrAlreadyUpToDate {
-						mutex.Lock()
-						alreadyUpToDate++
-						mutex.Unlock()
-						fmt.Printf("repo %s: already up to date\n", repo)
-						wg.Done()
-						continue
-					} else if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						log.Printf("push failed for %s: %v\n", repo, err)
-						wg.Done()
-						continue
-					}
-					fmt.Printf("successfully pushed %s\n", repo)
-					wg.Done()
-				}
-			}()
+	Args:  cobra.NoArgs,
+	Long: `push all git repos.
+
+--interactive picks the repos to push from a checklist of those with branches
+ahead of origin. --dry-run lists the refs on origin instead and shows the
+branches a push would create or update.`,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if err := checkJobs(); err != nil {
+			return err
 		}
-		for _, repo := range conf.Repos {
-			repoChan <- repo.Path
+		conf, err := GetConfig()
+		if err != nil {
+			return err
 		}
-		close(repoChan)
-		wg.Wait()
-		for _, err := range errs {
-			log.Printf("error pushing %s: %s\n", err.Repo, err.Error)
+		repos := conf.Repos
+		if pushInteractive {
+			repos, err = chooseRepos("push", pushCandidates(conf.Repos))
+			if err != nil || len(repos) == 0 {
+				return err
+			}
 		}
-		lenErrs := len(errs)
-		fmt.Println()
-		fmt.Printf("successfully pushed %d/%d repos\n", len(conf.Repos)-lenErrs, len(conf.Repos))
-		fmt.Printf("%d repos already up to date\n", alreadyUpToDate)
-		fmt.Printf("failed to push %d/%d repos\n", lenErrs, len(conf.Repos))
+		results := forEachRepoInOrder(cmd.Context(), repos, jobs, func(repo parse.Repo) repoResult {
+			if !dryRun {
+				repoLogf(repo.Path, "attempting push: %s\n", repo.Path)
+			}
+			r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			auth, err := remoteAuth(r, git.DefaultRemoteName)
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			if dryRun {
+				return pushPlan(r, repo.Path)
+			}
+			setPhase(repo.Path, "pushing")
+			err = r.PushContext(cmd.Context(), &git.PushOptions{
+				RefSpecs: []config.RefSpec{"refs/heads/*:refs/heads/*"},
+				Auth:     auth,
+				Progress: sideband(repo.Path),
+			})
+			if err == git.NoErrAlreadyUpToDate {
+				repoPrintf(repo.Path, "repo %s: already up to date\n", repo.Path)
+				return repoResult{Skipped: true}
+			} else if err != nil {
+				return repoResult{Err: err}
+			}
+			repoPrintf(repo.Path, "successfully pushed %s\n", repo.Path)
+			return repoResult{}
+		})
+		return printSummary(results, dryRunSummary(summary{Verb: "push", Past: "pushed", Skipped: "already up to date"}))
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(pushCmd)
 	pushCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	pushCmd.Flags().BoolVar(&pushInteractive, "interactive", false, "choose the repos to push from a checklist")
 }
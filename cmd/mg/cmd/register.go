@@ -1,8 +1,8 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"os"
 
 	git "github.com/go-git/go-git/v5"
@@ -12,59 +12,54 @@ import (
 var registerCmd = &cobra.Command{
 	Use:   "register",
 	Short: "add current path to list of repos",
-	Run: func(_ *cobra.Command, args []string) {
-		conf := GetConfig()
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conf, err := GetConfig()
+		if err != nil {
+			return err
+		}
 		path, err := os.Getwd()
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			return err
 		}
 		if len(args) == 1 {
 			path = args[0]
-		} else if len(args) > 1 {
-			log.Println("too many arguments")
-			os.Exit(1)
 		}
 		r, err := git.PlainOpenWithOptions(path, &(git.PlainOpenOptions{DetectDotGit: true}))
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			return &usageError{err}
 		}
 		remotes, err := r.Remotes()
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			return err
 		}
 		if len(remotes) == 0 {
-			log.Println("no remotes found")
-			os.Exit(1)
+			return errors.New("no remotes found")
 		}
 		remote := remotes[0]
 		urls := remote.Config().URLs
 		if len(urls) == 0 {
-			log.Println("no urls found for remote")
-			os.Exit(1)
+			return errors.New("no urls found for remote")
 		}
 		url := urls[0]
 		newPath, err := r.Worktree()
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			return err
 		}
 		path = newPath.Filesystem.Root()
 
 		for _, v := range conf.Repos {
 			if v.Path == path {
 				fmt.Printf("repo %s already registered\n", path)
-				os.Exit(0)
+				return nil
 			}
 		}
-		conf.AddRepo(path, url)
-		err = conf.Save()
-		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+		if dryRun {
+			fmt.Printf("would register %s with remote %s\n", path, url)
+			return nil
 		}
+		conf.AddRepo(path, url)
+		return conf.Save()
 	},
 }
 
@@ -0,0 +1,344 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
+)
+
+var errRemoteExists = errors.New("remote already exists")
+
+var (
+	remoteName string
+	remoteFrom string
+	remoteCmd  = &cobra.Command{
+		Use:   "remote",
+		Short: "list and change the remotes of all repos",
+	}
+	remoteListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "show a table of every repo's remotes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			var (
+				mutex   sync.Mutex
+				remotes = map[string][]*config.RemoteConfig{}
+			)
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				cfg, err := r.Config()
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				found := []*config.RemoteConfig{}
+				for _, rc := range cfg.Remotes {
+					found = append(found, rc)
+				}
+				sort.Slice(found, func(i, j int) bool {
+					return found[i].Name < found[j].Name
+				})
+				mutex.Lock()
+				remotes[repo.Path] = found
+				mutex.Unlock()
+				return repoResult{}
+			})
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "REPO\tREMOTE\tURL")
+			for _, repo := range conf.Repos {
+				found, ok := remotes[repo.Path]
+				if !ok {
+					continue
+				}
+				if len(found) == 0 {
+					fmt.Fprintf(tw, "%s\t-\t-\n", repo.Path)
+				}
+				for _, rc := range found {
+					fmt.Fprintf(tw, "%s\t%s\t%s\n", repo.Path, rc.Name, strings.Join(rc.URLs, ", "))
+				}
+			}
+			tw.Flush()
+			for _, res := range results {
+				if res.Err != nil {
+					log.Printf("error reading %s: %s\n", res.Repo, res.Err)
+				}
+			}
+			return resultsError(results, "read")
+		},
+	}
+	remoteSetURLCmd = &cobra.Command{
+		Use:   "set-url <regexp> <replacement>",
+		Short: "rewrite remote URLs in all repos with a regexp",
+		Long: `rewrite remote URLs in all repos with a regexp.
+
+Every URL of every remote (or only of --remote) that matches the regexp is
+rewritten. Unless --remote names another remote than origin, so is the
+remote stored in the mg config, so repos that are not cloned yet are cloned
+from the new URL. The replacement may refer to capture
+groups as $1 or ${name}, e.g.
+
+  mg remote set-url '^git@old.example.com:' 'git@new.example.com:'`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			pattern, err := regexp.Compile(args[0])
+			if err != nil {
+				return &usageError{err}
+			}
+			rewrite := func(url string) string {
+				return pattern.ReplaceAllString(url, args[1])
+			}
+			// the remote stored in the config is the one cloned as origin
+			rewriteStored := func(url string) string {
+				if remoteName != "" && remoteName != git.DefaultRemoteName {
+					return url
+				}
+				return rewrite(url)
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				changed := false
+				if stored := rewriteStored(repo.Remote); stored != repo.Remote {
+					repoPrintf(repo.Path, "%s: config: %s -> %s\n", repo.Path, repo.Remote, stored)
+					changed = true
+				}
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if errors.Is(err, git.ErrRepositoryNotExists) {
+					// not cloned yet, only the stored remote needs changing
+					return repoResult{Skipped: !changed}
+				} else if err != nil {
+					return repoResult{Err: err}
+				}
+				cfg, err := r.Config()
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				names := []string{}
+				for name := range cfg.Remotes {
+					if remoteName == "" || name == remoteName {
+						names = append(names, name)
+					}
+				}
+				sort.Strings(names)
+				repoChanged := false
+				for _, name := range names {
+					rc := cfg.Remotes[name]
+					for i, url := range rc.URLs {
+						if updated := rewrite(url); updated != url {
+							repoPrintf(repo.Path, "%s: %s: %s -> %s\n", repo.Path, name, url, updated)
+							rc.URLs[i] = updated
+							repoChanged = true
+						}
+					}
+				}
+				if !repoChanged {
+					return repoResult{Skipped: !changed}
+				}
+				if dryRun {
+					return repoResult{}
+				}
+				return repoResult{Err: r.SetConfig(cfg)}
+			})
+
+			stored := false
+			for i, repo := range conf.Repos {
+				if updated := rewriteStored(repo.Remote); updated != repo.Remote {
+					conf.Repos[i].Remote = updated
+					stored = true
+				}
+			}
+			if stored && !dryRun {
+				if err := conf.Save(); err != nil {
+					return err
+				}
+			}
+			return printSummary(results, dryRunSummary(summary{Verb: "update remotes in", Past: "updated remotes in", Skipped: "had no matching URLs"}))
+		},
+	}
+	remoteAddCmd = &cobra.Command{
+		Use:   "add <name> <regexp> <replacement>",
+		Short: "add a remote to all repos, deriving its URL from an existing remote",
+		Long: `add a remote to all repos, deriving its URL from an existing remote.
+
+The URL of the new remote is the first URL of --from (origin by default)
+rewritten with the regexp, e.g. to add a mirror of every repo:
+
+  mg remote add mirror '^git@github.com:' 'git@mirror.example.com:'
+
+Repos without --from, or whose URL does not match, are skipped.`,
+		Args: cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			name := args[0]
+			pattern, err := regexp.Compile(args[1])
+			if err != nil {
+				return &usageError{err}
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				cfg, err := r.Config()
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if _, ok := cfg.Remotes[name]; ok {
+					return repoResult{Err: fmt.Errorf("%w: %s", errRemoteExists, name)}
+				}
+				from, ok := cfg.Remotes[remoteFrom]
+				if !ok || len(from.URLs) == 0 || !pattern.MatchString(from.URLs[0]) {
+					return repoResult{Skipped: true}
+				}
+				url := pattern.ReplaceAllString(from.URLs[0], args[2])
+				repoPrintf(repo.Path, "%s: %s: %s\n", repo.Path, name, url)
+				if dryRun {
+					return repoResult{}
+				}
+				_, err = r.CreateRemote(&config.RemoteConfig{Name: name, URLs: []string{url}})
+				return repoResult{Err: err}
+			})
+			return printSummary(results, dryRunSummary(summary{Verb: "add remote to", Past: "added remote to", Skipped: "had no matching remote"}))
+		},
+	}
+	remoteRenameCmd = &cobra.Command{
+		Use:   "rename <old> <new>",
+		Short: "rename a remote in all repos",
+		Long: `rename a remote in all repos.
+
+The remote's fetch refspecs, remote-tracking branches and any branches
+tracking it are updated to the new name. Repos without the remote are
+skipped. The remote stored in the mg config is a URL and is unchanged.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				cfg, err := r.Config()
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if _, ok := cfg.Remotes[args[0]]; !ok {
+					return repoResult{Skipped: true}
+				}
+				if _, ok := cfg.Remotes[args[1]]; ok {
+					return repoResult{Err: fmt.Errorf("%w: %s", errRemoteExists, args[1])}
+				}
+				repoPrintf(repo.Path, "%s: %s -> %s\n", repo.Path, args[0], args[1])
+				if dryRun {
+					return repoResult{}
+				}
+				return repoResult{Err: renameRemote(r, cfg, args[0], args[1])}
+			})
+			return printSummary(results, dryRunSummary(summary{Verb: "rename remote in", Past: "renamed remote in", Skipped: "did not have the remote"}))
+		},
+	}
+)
+
+// renameRemote renames the remote old to name in r, like git remote rename.
+func renameRemote(r *git.Repository, cfg *config.Config, old, name string) error {
+	rc := cfg.Remotes[old]
+	delete(cfg.Remotes, old)
+	rc.Name = name
+	oldPrefix := "refs/remotes/" + old + "/"
+	newPrefix := "refs/remotes/" + name + "/"
+	for i, spec := range rc.Fetch {
+		rc.Fetch[i] = config.RefSpec(strings.Replace(spec.String(), ":"+oldPrefix, ":"+newPrefix, 1))
+	}
+	cfg.Remotes[name] = rc
+	for _, b := range cfg.Branches {
+		if b.Remote == old {
+			b.Remote = name
+		}
+	}
+	if err := r.SetConfig(cfg); err != nil {
+		return err
+	}
+
+	refs, err := r.References()
+	if err != nil {
+		return err
+	}
+	defer refs.Close()
+	moved := []*plumbing.Reference{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if strings.HasPrefix(ref.Name().String(), oldPrefix) {
+			moved = append(moved, ref)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, ref := range moved {
+		target := plumbing.ReferenceName(newPrefix + strings.TrimPrefix(ref.Name().String(), oldPrefix))
+		var renamed *plumbing.Reference
+		if ref.Type() == plumbing.SymbolicReference {
+			// e.g. refs/remotes/origin/HEAD -> refs/remotes/origin/main
+			dest := plumbing.ReferenceName(strings.Replace(ref.Target().String(), oldPrefix, newPrefix, 1))
+			renamed = plumbing.NewSymbolicReference(target, dest)
+		} else {
+			renamed = plumbing.NewHashReference(target, ref.Hash())
+		}
+		if err := r.Storer.SetReference(renamed); err != nil {
+			return err
+		}
+		if err := r.Storer.RemoveReference(ref.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(remoteCmd)
+	remoteCmd.AddCommand(remoteListCmd, remoteSetURLCmd, remoteAddCmd, remoteRenameCmd)
+	for _, c := range []*cobra.Command{remoteListCmd, remoteSetURLCmd, remoteAddCmd, remoteRenameCmd} {
+		c.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	}
+	remoteSetURLCmd.Flags().StringVar(&remoteName, "remote", "", "only rewrite the URLs of this remote")
+	remoteAddCmd.Flags().StringVar(&remoteFrom, "from", "origin", "remote whose URL the new URL is derived from")
+}
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
+)
+
+// fileReplacement is a pending change to a single tracked file.
+type fileReplacement struct {
+	Path string
+	Mode os.FileMode
+	Old  string
+	New  string
+}
+
+var (
+	replaceGlobs   []string
+	replaceApply   bool
+	replaceCommit  bool
+	replaceMessage string
+	replaceCmd     = &cobra.Command{
+		Use:   "replace <regexp> <replacement>",
+		Short: "search and replace in tracked files across all repos",
+		Long: `search and replace in tracked files across all repos.
+
+The replacement may refer to capture groups as $1 or ${name}. By default a
+unified diff of the changes is printed and nothing is written; pass --apply
+to write the files, and --commit -m to also commit just the touched files in
+each repo. --dry-run only shows the diff, even with --apply. Repos with
+uncommitted changes are skipped.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			if replaceCommit && !replaceApply {
+				return usageErrorf("--commit requires --apply")
+			}
+			if replaceCommit && replaceMessage == "" {
+				return usageErrorf("commit message is required (-m)")
+			}
+			pattern, err := regexp.Compile(args[0])
+			if err != nil {
+				return &usageError{err}
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			var (
+				mutex   sync.Mutex
+				pending = map[string][]fileReplacement{}
+			)
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				w, err := r.Worktree()
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				st, err := w.Status()
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if hasChanges(st) {
+					repoPrintf(repo.Path, "repo %s: skipping, has uncommitted changes\n", repo.Path)
+					return repoResult{Skipped: true}
+				}
+				changes, err := findReplacements(r, w.Filesystem.Root(), pattern, args[1], replaceGlobs)
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if len(changes) == 0 {
+					return repoResult{Skipped: true}
+				}
+				mutex.Lock()
+				pending[repo.Path] = changes
+				mutex.Unlock()
+				if !replaceApply || dryRun {
+					return repoResult{}
+				}
+				for _, c := range changes {
+					full := filepath.Join(w.Filesystem.Root(), c.Path)
+					if err := os.WriteFile(full, []byte(c.New), c.Mode); err != nil {
+						return repoResult{Err: err}
+					}
+				}
+				if !replaceCommit {
+					return repoResult{}
+				}
+				for _, c := range changes {
+					if _, err := w.Add(c.Path); err != nil {
+						return repoResult{Err: err}
+					}
+				}
+				if _, err := w.Commit(replaceMessage, &git.CommitOptions{}); err != nil {
+					return repoResult{Err: err}
+				}
+				return repoResult{}
+			})
+
+			files := 0
+			for _, repo := range conf.Repos {
+				changes := pending[repo.Path]
+				if len(changes) == 0 {
+					continue
+				}
+				files += len(changes)
+				fmt.Printf("%s:\n", repo.Path)
+				if err := fdiff.NewUnifiedEncoder(os.Stdout, fdiff.DefaultContextLines).Encode(replacementPatch(changes)); err != nil {
+					log.Println(err)
+				}
+				fmt.Println()
+			}
+			switch {
+			case replaceCommit && !dryRun:
+				return printSummary(results, summary{Verb: "commit replacements in", Past: "committed replacements in", Skipped: "had nothing to replace or were dirty"})
+			case replaceApply && !dryRun:
+				return printSummary(results, summary{Verb: "replace in", Past: "replaced in", Skipped: "had nothing to replace or were dirty"})
+			default:
+				for _, res := range results {
+					if res.Err != nil {
+						log.Printf("error reading %s: %s\n", res.Repo, res.Err)
+					}
+				}
+				hint := "with --apply to write them"
+				if dryRun {
+					hint = "without --dry-run to write them"
+				}
+				fmt.Printf("%d files in %d repos would change, run again %s\n", files, len(pending), hint)
+				return resultsError(results, "read")
+			}
+		},
+	}
+)
+
+// findReplacements applies pattern to every tracked text file in the
+// worktree at root that matches globs, returning the files that change.
+func findReplacements(r *git.Repository, root string, pattern *regexp.Regexp, replacement string, globs []string) ([]fileReplacement, error) {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	changes := []fileReplacement{}
+	for _, entry := range idx.Entries {
+		if entry.Mode != filemode.Regular && entry.Mode != filemode.Executable {
+			continue
+		}
+		if !matchesGlobs(entry.Name, globs) {
+			continue
+		}
+		full := filepath.Join(root, entry.Name)
+		info, err := os.Lstat(full)
+		if err != nil {
+			// tracked files deleted from the worktree have nothing to replace
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		b, err := os.ReadFile(full)
+		if err != nil {
+			return nil, err
+		}
+		if isBinary(b) {
+			continue
+		}
+		old := string(b)
+		updated := pattern.ReplaceAllString(old, replacement)
+		if updated == old {
+			continue
+		}
+		changes = append(changes, fileReplacement{Path: entry.Name, Mode: info.Mode().Perm(), Old: old, New: updated})
+	}
+	return changes, nil
+}
+
+// isBinary uses the same heuristic as git: a NUL byte in the first 8000
+// bytes means the file is binary.
+func isBinary(b []byte) bool {
+	if len(b) > 8000 {
+		b = b[:8000]
+	}
+	return bytes.IndexByte(b, 0) >= 0
+}
+
+// replacementPatch adapts a set of file replacements to go-git's patch
+// interfaces so they can be printed with its unified diff encoder.
+type replacementPatch []fileReplacement
+
+func (p replacementPatch) Message() string { return "" }
+
+func (p replacementPatch) FilePatches() []fdiff.FilePatch {
+	patches := make([]fdiff.FilePatch, len(p))
+	for i, c := range p {
+		patches[i] = replacementFilePatch(c)
+	}
+	return patches
+}
+
+type replacementFilePatch fileReplacement
+
+func (p replacementFilePatch) IsBinary() bool { return false }
+
+func (p replacementFilePatch) Files() (fdiff.File, fdiff.File) {
+	mode := filemode.Regular
+	if p.Mode&0o111 != 0 {
+		mode = filemode.Executable
+	}
+	return replacementFile{path: p.Path, mode: mode, content: p.Old},
+		replacementFile{path: p.Path, mode: mode, content: p.New}
+}
+
+func (p replacementFilePatch) Chunks() []fdiff.Chunk {
+	chunks := []fdiff.Chunk{}
+	for _, d := range diff.Do(p.Old, p.New) {
+		op := fdiff.Equal
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = fdiff.Add
+		case diffmatchpatch.DiffDelete:
+			op = fdiff.Delete
+		}
+		chunks = append(chunks, replacementChunk{content: d.Text, op: op})
+	}
+	return chunks
+}
+
+type replacementFile struct {
+	path    string
+	mode    filemode.FileMode
+	content string
+}
+
+func (f replacementFile) Hash() plumbing.Hash {
+	return plumbing.ComputeHash(plumbing.BlobObject, []byte(f.content))
+}
+func (f replacementFile) Mode() filemode.FileMode { return f.mode }
+func (f replacementFile) Path() string            { return f.path }
+
+type replacementChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c replacementChunk) Content() string       { return c.content }
+func (c replacementChunk) Type() fdiff.Operation { return c.op }
+
+func init() {
+	RootCmd.AddCommand(replaceCmd)
+	replaceCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	replaceCmd.Flags().StringSliceVarP(&replaceGlobs, "glob", "g", nil, "only change files matching this glob (repeatable)")
+	replaceCmd.Flags().BoolVar(&replaceApply, "apply", false, "write the changes instead of only showing them")
+	replaceCmd.Flags().BoolVar(&replaceCommit, "commit", false, "commit the touched files in each repo (requires --apply)")
+	replaceCmd.Flags().StringVarP(&replaceMessage, "message", "m", "", "commit message for --commit")
+}
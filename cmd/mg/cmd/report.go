@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// reportSpecs are the values of --report, each format=file.
+var reportSpecs []string
+
+// reportFormats are the formats --report can write.
+var reportFormats = map[string]func(reportRun) ([]byte, error){
+	"junit":    junitReport,
+	"markdown": markdownReport,
+}
+
+// reportTarget is a report to write, parsed from --report.
+type reportTarget struct {
+	Format string
+	File   string
+}
+
+// reportRun is everything recorded about one mg invocation, for --report
+// and the journal. A command adds a suite every time it reports the results
+// of running against the repos; most commands have a single suite, mg tag
+// --push has one for tagging and one for pushing.
+type reportRun struct {
+	Command string
+	Started time.Time
+	Suites  []reportSuite
+}
+
+type reportSuite struct {
+	Verb    string
+	Skipped string
+	Results []repoResult
+}
+
+var (
+	reportTargets []reportTarget
+	report        = reportRun{Started: time.Now()}
+)
+
+// parseReportSpecs checks the values of --report for the command c.
+func parseReportSpecs(c *cobra.Command) error {
+	report.Command = c.CommandPath()
+	reportTargets = nil
+	for _, spec := range reportSpecs {
+		format, file, ok := strings.Cut(spec, "=")
+		if !ok || file == "" {
+			return usageErrorf("invalid --report %q, expected format=file", spec)
+		}
+		if _, ok := reportFormats[format]; !ok {
+			return usageErrorf("unknown report format %q, expected junit or markdown", format)
+		}
+		reportTargets = append(reportTargets, reportTarget{Format: format, File: file})
+	}
+	return nil
+}
+
+// recordResults adds results to the run and rewrites the report files, so
+// they are complete even when a later step of the command fails.
+func recordResults(results []repoResult, s summary) error {
+	if s.Skipped == "" {
+		s.Skipped = "skipped"
+	}
+	report.Suites = append(report.Suites, reportSuite{Verb: s.Verb, Skipped: s.Skipped, Results: results})
+	for _, target := range reportTargets {
+		data, err := reportFormats[target.Format](report)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(target.File, data, 0o644); err != nil {
+			return fmt.Errorf("writing %s report: %w", target.Format, err)
+		}
+	}
+	return nil
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+type junitTestsuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestsuite `xml:"testsuite"`
+}
+
+type junitTestsuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestcase `xml:"testcase"`
+}
+
+type junitTestcase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// junitReport renders run as JUnit XML, with a testsuite per suite and a
+// testcase per repo. Failures carry the cause they are grouped by in the
+// summary as their type.
+func junitReport(run reportRun) ([]byte, error) {
+	all := junitTestsuites{Name: run.Command}
+	var total time.Duration
+	for _, s := range run.Suites {
+		suite := junitTestsuite{
+			Name:      s.Verb,
+			Tests:     len(s.Results),
+			Timestamp: run.Started.Format(time.RFC3339),
+		}
+		var elapsed time.Duration
+		for _, res := range s.Results {
+			elapsed += res.Duration
+			tc := junitTestcase{
+				Name:      res.Repo,
+				Classname: run.Command,
+				Time:      seconds(res.Duration),
+				SystemOut: res.Output,
+			}
+			switch {
+			case res.Err != nil:
+				suite.Failures++
+				tc.Failure = &junitMessage{Message: res.Err.Error(), Type: categorize(res.Err).Name, Text: res.Err.Error()}
+			case res.Skipped:
+				suite.Skipped++
+				tc.Skipped = &junitMessage{Message: s.Skipped}
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suite.Time = seconds(elapsed)
+		total += elapsed
+		all.Tests += suite.Tests
+		all.Failures += suite.Failures
+		all.Skipped += suite.Skipped
+		all.Suites = append(all.Suites, suite)
+	}
+	all.Time = seconds(total)
+	data, err := xml.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// markdownReport renders run as Markdown for PR comments: a table of the
+// outcome of every repo, followed by the errors and output of the repos
+// that have any in collapsed sections.
+func markdownReport(run reportRun) ([]byte, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## `%s`\n", run.Command)
+	for _, s := range run.Suites {
+		succeeded, skipped, failed := 0, 0, 0
+		var elapsed time.Duration
+		for _, res := range s.Results {
+			elapsed += res.Duration
+			switch {
+			case res.Err != nil:
+				failed++
+			case res.Skipped:
+				skipped++
+			default:
+				succeeded++
+			}
+		}
+		fmt.Fprintf(&b, "\n### %s: %d succeeded, %d skipped, %d failed in %s\n\n",
+			s.Verb, succeeded, skipped, failed, elapsed.Round(time.Millisecond))
+		b.WriteString("| Repo | Outcome | Duration |\n")
+		b.WriteString("| --- | --- | --- |\n")
+		for _, res := range s.Results {
+			outcome := "succeeded"
+			switch {
+			case res.Err != nil:
+				outcome = "**failed** (" + categorize(res.Err).Name + ")"
+			case res.Skipped:
+				outcome = "skipped, " + s.Skipped
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", res.Repo, outcome, res.Duration.Round(time.Millisecond))
+		}
+		for _, res := range s.Results {
+			text := res.Output
+			if res.Err != nil {
+				if text != "" {
+					text += "\n"
+				}
+				text += "error: " + res.Err.Error()
+			}
+			if text == "" {
+				continue
+			}
+			fence := "```"
+			for strings.Contains(text, fence) {
+				fence += "`"
+			}
+			fmt.Fprintf(&b, "\n<details><summary><code>%s</code></summary>\n\n%s\n%s\n%s\n\n</details>\n", res.Repo, fence, text, fence)
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+// repoOutput is what the repos in the running forEachRepo printed, by the
+// path of the repo, so reports can show the output of each repo. It is only
+// kept while reports are written.
+var repoOutput struct {
+	mutex sync.Mutex
+	lines map[string][]string
+}
+
+// startCapture starts keeping the output of repos if reports are written.
+func startCapture() {
+	repoOutput.mutex.Lock()
+	defer repoOutput.mutex.Unlock()
+	repoOutput.lines = nil
+	if len(reportTargets) > 0 {
+		repoOutput.lines = map[string][]string{}
+	}
+}
+
+// finishCapture stops keeping the output of repos and returns what every
+// repo printed.
+func finishCapture() map[string]string {
+	repoOutput.mutex.Lock()
+	defer repoOutput.mutex.Unlock()
+	output := map[string]string{}
+	for path, lines := range repoOutput.lines {
+		output[path] = strings.Join(lines, "\n")
+	}
+	repoOutput.lines = nil
+	return output
+}
+
+// capture adds s to the output of the repo at path.
+func capture(path, s string) {
+	repoOutput.mutex.Lock()
+	defer repoOutput.mutex.Unlock()
+	if repoOutput.lines != nil {
+		repoOutput.lines[path] = append(repoOutput.lines[path], strings.TrimSuffix(s, "\n"))
+	}
+}
+
+// repoPrintf prints like fmt.Printf, as output of the repo at path.
+func repoPrintf(path, format string, args ...any) {
+	s := fmt.Sprintf(format, args...)
+	fmt.Print(s)
+	capture(path, s)
+}
+
+// repoLogf logs like log.Printf, as output of the repo at path.
+func repoLogf(path, format string, args ...any) {
+	s := fmt.Sprintf(format, args...)
+	log.Print(s)
+	capture(path, s)
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringArrayVar(&reportSpecs, "report", nil, "write a report of the outcome of every repo, as junit=<file> or markdown=<file> (repeatable)")
+}
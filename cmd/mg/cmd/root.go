@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/cobra"
 )
 
@@ -8,5 +11,37 @@ import (
 var RootCmd = &cobra.Command{
 	Use:   "mg",
 	Short: "go replacement for myrepos which only supports git repos",
-	Long:  "mg is a go replacement for myrepos which only supports git repos.",
+	Long: `mg is a go replacement for myrepos which only supports git repos.
+
+mg exits with 0 on success, 1 if the command failed for some repos, 2 on
+invalid arguments, flags or config, and 130 when interrupted.`,
+	Args: func(c *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return nil
+		}
+		msg := fmt.Sprintf("unknown command %q for %q", args[0], c.CommandPath())
+		if suggestions := c.SuggestionsFor(args[0]); len(suggestions) > 0 {
+			msg += "\n\nDid you mean this?\n\t" + strings.Join(suggestions, "\n\t")
+		}
+		return usageErrorf("%s", msg)
+	},
+	// runnable so unknown commands are reported as usage errors, rather
+	// than as failures by cobra's command lookup
+	RunE: func(c *cobra.Command, _ []string) error {
+		return c.Help()
+	},
+}
+
+func init() {
+	RootCmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return &usageError{err}
+	})
+	// all commands are added by now, cobra runs this before validating args
+	cobra.OnInitialize(func() { usageArgs(RootCmd) })
+	RootCmd.PersistentPreRunE = func(c *cobra.Command, _ []string) error {
+		if err := checkKnownHostsMode(); err != nil {
+			return err
+		}
+		return parseReportSpecs(c)
+	}
 }
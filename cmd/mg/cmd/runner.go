@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"github.com/taigrr/mg/parse"
+)
+
+// repoResult is the outcome of running a command against a single repo.
+// Skipped marks repos where there was nothing to do, such as a repo that is
+// already up to date. Output is what the repo printed with repoPrintf and
+// repoLogf, and is only kept when reports are written.
+type repoResult struct {
+	Repo     string
+	Skipped  bool
+	Err      error
+	Duration time.Duration
+	Output   string
+}
+
+var errDependencyFailed = errors.New("skipped because a dependency failed")
+
+// summary describes how the results of a command are reported, e.g.
+// "push", "pushed" and "already up to date".
+type summary struct {
+	Verb    string
+	Past    string
+	Skipped string
+}
+
+// forEachRepo runs fn against every repo using jobs workers and returns the
+// results in the same order as repos. Once ctx is cancelled no more repos
+// are started, and those left fail as cancelled. On a terminal, progress is
+// shown live while the repos run.
+func forEachRepo(ctx context.Context, repos []parse.Repo, jobs int, fn func(parse.Repo) repoResult) []repoResult {
+	return runRepos(ctx, repos, jobs, nil, fn)
+}
+
+// forEachRepoInOrder is forEachRepo for commands that change repos, such as
+// pull and push, where the order matters: a repo is only started once all
+// of the repos it depends on have finished, so independent repos still run
+// in parallel. Repos whose dependencies failed are not run and fail as well.
+func forEachRepoInOrder(ctx context.Context, repos []parse.Repo, jobs int, fn func(parse.Repo) repoResult) []repoResult {
+	return runRepos(ctx, repos, jobs, dependencies, fn)
+}
+
+// runRepos runs fn against repos, scheduling them by deps, a map from repo
+// path to the paths of the repos it depends on. Dependencies outside of
+// repos are not waited for.
+func runRepos(ctx context.Context, repos []parse.Repo, jobs int, deps map[string][]string, fn func(parse.Repo) repoResult) []repoResult {
+	repos = selectRepos(repos)
+	results := make([]repoResult, len(repos))
+	index := map[string]int{}
+	for i, repo := range repos {
+		index[repo.Path] = i
+	}
+	waiting := make([]int, len(repos))
+	dependents := make([][]int, len(repos))
+	for i, repo := range repos {
+		for _, dep := range deps[repo.Path] {
+			if j, ok := index[dep]; ok && j != i {
+				waiting[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+	failedDep := make([]string, len(repos))
+	view := startProgress(len(repos))
+	startCapture()
+	ready := make(chan int, len(repos))
+	done := make(chan int)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			for i := range ready {
+				var res repoResult
+				if ctx.Err() != nil {
+					res = repoResult{Err: errCancelled}
+				} else if failedDep[i] != "" {
+					res = repoResult{Err: fmt.Errorf("%w: %s", errDependencyFailed, failedDep[i])}
+				} else {
+					view.begin(repos[i].Path)
+					start := time.Now()
+					res = fn(repos[i])
+					res.Duration = time.Since(start)
+				}
+				view.end(repos[i].Path)
+				res.Repo = repos[i].Path
+				results[i] = res
+				done <- i
+			}
+		}()
+	}
+	for i := range repos {
+		if waiting[i] == 0 {
+			ready <- i
+		}
+	}
+	for finished := 0; finished < len(repos); finished++ {
+		i := <-done
+		for _, d := range dependents[i] {
+			if results[i].Err != nil && failedDep[d] == "" {
+				failedDep[d] = repos[i].Path
+			}
+			waiting[d]--
+			if waiting[d] == 0 {
+				ready <- d
+			}
+		}
+	}
+	close(ready)
+	output := finishCapture()
+	for i := range results {
+		results[i].Output = output[results[i].Repo]
+	}
+	view.finish()
+	return results
+}
+
+// failureCategory groups failed repos whose errors have the same cause, so
+// they can be reported and fixed together.
+type failureCategory struct {
+	Name  string
+	Hint  string
+	Match func(error) bool
+}
+
+// failureCategories are checked in order, the first match wins.
+var failureCategories = []failureCategory{
+	{"cancelled", "", func(err error) bool {
+		return errors.Is(err, errCancelled) || errors.Is(err, context.Canceled)
+	}},
+	{"dependency failed", "fix the repos they depend on first", func(err error) bool {
+		return errors.Is(err, errDependencyFailed)
+	}},
+	{"SSH host key", "check known_hosts or see --known-hosts", func(err error) bool {
+		return errors.Is(err, errHostKey)
+	}},
+	{"authentication", "check the auth settings for the host in the config", func(err error) bool {
+		var auth *authError
+		return errors.As(err, &auth) ||
+			errors.Is(err, transport.ErrAuthenticationRequired) ||
+			errors.Is(err, transport.ErrAuthorizationFailed)
+	}},
+	{"git hook", "fix what the hook reported or rerun with --no-verify", func(err error) bool {
+		return errors.Is(err, errHookFailed)
+	}},
+	{"no good signature", "sign it, or add the signer to the keyring or allowed signers", func(err error) bool {
+		return errors.Is(err, errNotVerified)
+	}},
+	{"uncommitted changes", "commit or stash the changes first", func(err error) bool {
+		return errors.Is(err, errDirtyWorktree) ||
+			errors.Is(err, git.ErrUnstagedChanges) ||
+			errors.Is(err, git.ErrWorktreeNotClean)
+	}},
+	{"diverged", "pull or rebase before pushing", func(err error) bool {
+		return errors.Is(err, git.ErrNonFastForwardUpdate)
+	}},
+	{"not cloned", "run mg clone or unregister the repo", func(err error) bool {
+		return errors.Is(err, git.ErrRepositoryNotExists)
+	}},
+	{"remote not found", "check the remote URL", func(err error) bool {
+		return errors.Is(err, transport.ErrRepositoryNotFound)
+	}},
+	{"network", "check the connection to the remote", func(err error) bool {
+		var netErr net.Error
+		return errors.As(err, &netErr)
+	}},
+	{"other", "", func(error) bool { return true }},
+}
+
+func categorize(err error) failureCategory {
+	for _, c := range failureCategories {
+		if c.Match(err) {
+			return c
+		}
+	}
+	return failureCategories[len(failureCategories)-1]
+}
+
+// printSummary logs every failed repo and prints the success, skip and
+// failure counts for a command, with the failed repos grouped by the cause
+// of their failure. It returns the error the command exits with.
+func printSummary(results []repoResult, s summary) error {
+	failed, skipped := 0, 0
+	groups := map[string][]string{}
+	for _, res := range results {
+		switch {
+		case res.Err != nil:
+			failed++
+			category := categorize(res.Err)
+			if category.Name != "cancelled" {
+				log.Printf("failed to %s %s: %s\n", s.Verb, res.Repo, res.Err)
+			}
+			groups[category.Name] = append(groups[category.Name], res.Repo)
+		case res.Skipped:
+			skipped++
+		}
+	}
+	total := len(results)
+	fmt.Println()
+	fmt.Printf("successfully %s %d/%d repos\n", s.Past, total-failed-skipped, total)
+	fmt.Printf("%d repos %s\n", skipped, s.Skipped)
+	fmt.Printf("failed to %s %d/%d repos\n", s.Verb, failed, total)
+	if failed > 0 {
+		fmt.Println()
+		fmt.Println("failures by cause:")
+		for _, c := range failureCategories {
+			repos := groups[c.Name]
+			if len(repos) == 0 {
+				continue
+			}
+			fmt.Printf("  %s: %d repos\n", c.Name, len(repos))
+			if c.Hint != "" {
+				fmt.Printf("    %s\n", c.Hint)
+			}
+			for _, repo := range repos {
+				fmt.Printf("    %s\n", repo)
+			}
+		}
+	}
+	return reportResults(results, s)
+}
+
+// resultsError returns the error a command that reports on the repos itself,
+// rather than with printSummary, exits with.
+func resultsError(results []repoResult, verb string) error {
+	return reportResults(results, summary{Verb: verb})
+}
+
+// reportResults records results for --report and the journal, and returns
+// the error the command exits with.
+func reportResults(results []repoResult, s summary) error {
+	if err := recordResults(results, s); err != nil {
+		return err
+	}
+	failed, cancelled := 0, 0
+	for _, res := range results {
+		if res.Err == nil {
+			continue
+		}
+		failed++
+		if categorize(res.Err).Name == "cancelled" {
+			cancelled++
+		}
+	}
+	switch {
+	case cancelled > 0:
+		return fmt.Errorf("%w after %d/%d repos", errCancelled, len(results)-cancelled, len(results))
+	case failed > 0:
+		return &reposFailedError{Verb: s.Verb, Failed: failed, Total: len(results)}
+	}
+	return nil
+}
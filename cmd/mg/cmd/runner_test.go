@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/taigrr/mg/parse"
+)
+
+func testRepos(paths ...string) []parse.Repo {
+	repos := make([]parse.Repo, len(paths))
+	for i, path := range paths {
+		repos[i] = parse.Repo{Path: path}
+	}
+	return repos
+}
+
+func TestRunRepos_Order(t *testing.T) {
+	deps := map[string][]string{
+		"/a": {"/b"},
+		"/c": {"/a"},
+	}
+	var (
+		mutex  sync.Mutex
+		events []string
+	)
+	results := runRepos(context.Background(), testRepos("/a", "/b", "/c", "/d"), 4, deps, func(repo parse.Repo) repoResult {
+		mutex.Lock()
+		events = append(events, "start "+repo.Path)
+		mutex.Unlock()
+		// other repos may start meanwhile
+		runtime.Gosched()
+		mutex.Lock()
+		events = append(events, "end "+repo.Path)
+		mutex.Unlock()
+		return repoResult{}
+	})
+
+	for i, path := range []string{"/a", "/b", "/c", "/d"} {
+		if results[i].Repo != path || results[i].Err != nil {
+			t.Errorf("result %d: expected %s to succeed, got %+v", i, path, results[i])
+		}
+	}
+	before := func(a, b string) {
+		t.Helper()
+		if i, j := slices.Index(events, a), slices.Index(events, b); i < 0 || j < 0 || i > j {
+			t.Errorf("expected %q before %q, got %v", a, b, events)
+		}
+	}
+	before("end /b", "start /a")
+	before("end /a", "start /c")
+}
+
+func TestRunRepos_DependencyFailed(t *testing.T) {
+	deps := map[string][]string{
+		"/a": {"/b"},
+		"/c": {"/a"},
+	}
+	errBroken := errors.New("broken")
+	var (
+		mutex sync.Mutex
+		ran   []string
+	)
+	results := runRepos(context.Background(), testRepos("/a", "/b", "/c", "/d"), 2, deps, func(repo parse.Repo) repoResult {
+		mutex.Lock()
+		ran = append(ran, repo.Path)
+		mutex.Unlock()
+		if repo.Path == "/b" {
+			return repoResult{Err: errBroken}
+		}
+		return repoResult{}
+	})
+
+	slices.Sort(ran)
+	if want := []string{"/b", "/d"}; !slices.Equal(ran, want) {
+		t.Errorf("expected only %v to run, got %v", want, ran)
+	}
+	if !errors.Is(results[1].Err, errBroken) {
+		t.Errorf("expected /b to fail with its own error, got %v", results[1].Err)
+	}
+	for _, i := range []int{0, 2} {
+		if !errors.Is(results[i].Err, errDependencyFailed) {
+			t.Errorf("expected %s to fail as a dependency failed, got %v", results[i].Repo, results[i].Err)
+		}
+	}
+	if results[3].Err != nil {
+		t.Errorf("expected the independent repo to succeed, got %v", results[3].Err)
+	}
+}
+
+func TestRunRepos_DependencyNotSelected(t *testing.T) {
+	deps := map[string][]string{"/a": {"/elsewhere"}}
+	results := runRepos(context.Background(), testRepos("/a"), 1, deps, func(parse.Repo) repoResult {
+		return repoResult{}
+	})
+	if len(results) != 1 || results[0].Err != nil {
+		t.Errorf("expected /a to run without waiting for a repo outside the run, got %+v", results)
+	}
+}
+
+func TestForEachRepo_IgnoresDependencies(t *testing.T) {
+	dependencies = map[string][]string{"/a": {"/b"}}
+	t.Cleanup(func() { dependencies = nil })
+	results := forEachRepo(context.Background(), testRepos("/a", "/b"), 1, func(repo parse.Repo) repoResult {
+		if repo.Path == "/b" {
+			return repoResult{Err: errors.New("unreadable")}
+		}
+		return repoResult{}
+	})
+	if results[0].Err != nil {
+		t.Errorf("expected /a to run although /b failed, got %v", results[0].Err)
+	}
+}
+
+func TestResolveDependencies_GoModCycle(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for path, gomod := range map[string]string{
+		a: "module example.com/a\n\nrequire example.com/b v1.0.0\n",
+		b: "module example.com/b\n\nrequire example.com/a v0.9.0\n",
+	} {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(path, "go.mod"), []byte(gomod), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deps, err := resolveDependencies(parse.MGConfig{Repos: testRepos(a, b)})
+	if err != nil {
+		t.Fatalf("resolveDependencies() unexpected error for a go.mod cycle: %v", err)
+	}
+	if len(deps[a])+len(deps[b]) != 1 {
+		t.Errorf("expected one of the two requirements to be kept, got %v", deps)
+	}
+	if err := parse.CheckDependencies(deps); err != nil {
+		t.Errorf("expected the cycle to be broken, got %v", err)
+	}
+
+	conf := parse.MGConfig{Repos: testRepos(a, b)}
+	conf.Repos[0].DependsOn = []string{b}
+	conf.Repos[1].DependsOn = []string{a}
+	if _, err := resolveDependencies(conf); !errors.Is(err, parse.ErrDependencyCycle) {
+		t.Errorf("expected a DependsOn cycle to be an error, got %v", err)
+	}
+}
+
+func TestRunRepos_Output(t *testing.T) {
+	reportTargets = []reportTarget{{Format: "junit", File: filepath.Join(t.TempDir(), "report.xml")}}
+	t.Cleanup(func() { reportTargets = nil })
+	// /a is a prefix of /ab, output must still go to the repo printing it
+	results := forEachRepo(context.Background(), testRepos("/a", "/ab"), 2, func(repo parse.Repo) repoResult {
+		repoPrintf(repo.Path, "updated %s\n", "/ab")
+		repoLogf(repo.Path, "done")
+		return repoResult{}
+	})
+	for _, res := range results {
+		if res.Output != "updated /ab\ndone" {
+			t.Errorf("%s: expected its own output, got %q", res.Repo, res.Output)
+		}
+	}
+}
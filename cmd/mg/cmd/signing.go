@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/taigrr/mg/parse"
+)
+
+var errNoSigningKey = errors.New("no signing key configured")
+
+// signers caches loaded signing keys by format and key, so a passphrase is
+// only asked for once even when many repos are signed in parallel.
+var signers = struct {
+	sync.Mutex
+	m map[string]git.Signer
+}{m: map[string]git.Signer{}}
+
+// signingSettings resolves how to sign in r. A key given on the command line
+// takes precedence, with its format detected from the file; otherwise the
+// mg config is used, falling back to git's own config.
+func signingSettings(r *git.Repository, configured *parse.Signing, key string) (parse.Signing, error) {
+	settings := parse.Signing{}
+	if configured != nil {
+		settings = *configured
+	}
+	cfg, err := r.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return settings, err
+	}
+	gpg := cfg.Raw.Section("gpg")
+	if settings.Format == "" {
+		settings.Format = gpg.Option("format")
+	}
+	if settings.Key == "" {
+		settings.Key = cfg.Raw.Section("user").Option("signingkey")
+	}
+	if settings.AllowedSigners == "" {
+		settings.AllowedSigners = gpg.Subsection("ssh").Option("allowedSignersFile")
+	}
+	if key != "" {
+		settings.Key = key
+		settings.Format = ""
+	}
+	if settings.Format == "" && settings.Key != "" {
+		settings.Format = detectSigningFormat(settings.Key)
+	}
+	switch settings.Format {
+	case parse.SigningOpenPGP, parse.SigningSSH:
+	case "":
+		settings.Format = parse.SigningOpenPGP
+	default:
+		return settings, fmt.Errorf("unsupported signing format %q", settings.Format)
+	}
+	return settings, nil
+}
+
+// detectSigningFormat guesses whether key is an SSH or OpenPGP key.
+func detectSigningFormat(key string) string {
+	if strings.HasPrefix(key, "key::") {
+		return parse.SigningSSH
+	}
+	b, err := os.ReadFile(expandHome(key))
+	if err != nil {
+		return parse.SigningOpenPGP
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey(b); err == nil {
+		return parse.SigningSSH
+	}
+	_, err = ssh.ParseRawPrivateKey(b)
+	var missing *ssh.PassphraseMissingError
+	if err == nil || errors.As(err, &missing) {
+		return parse.SigningSSH
+	}
+	return parse.SigningOpenPGP
+}
+
+// repoSigner returns the signer for the repo at path.
+func repoSigner(path string, configured *parse.Signing, key string) (git.Signer, error) {
+	r, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, err
+	}
+	settings, err := signingSettings(r, configured, key)
+	if err != nil {
+		return nil, err
+	}
+	return loadSigner(settings)
+}
+
+// loadSigner returns the signer for settings, loading the key on first use.
+func loadSigner(settings parse.Signing) (git.Signer, error) {
+	if settings.Key == "" {
+		return nil, fmt.Errorf("%w: set signing.key in the mg config, user.signingkey in git or pass --sign-key", errNoSigningKey)
+	}
+	signers.Lock()
+	defer signers.Unlock()
+	id := settings.Format + ":" + settings.Key
+	if s, ok := signers.m[id]; ok {
+		return s, nil
+	}
+	var (
+		s   git.Signer
+		err error
+	)
+	if settings.Format == parse.SigningSSH {
+		var key ssh.Signer
+		key, err = loadSSHSigningKey(settings.Key)
+		s = sshSigner{key}
+	} else {
+		if !fileExists(expandHome(settings.Key)) {
+			return nil, fmt.Errorf("signing key %s is not a file, OpenPGP keys have to be exported to a keyring file", settings.Key)
+		}
+		var entity *openpgp.Entity
+		entity, err = loadSigningKey(expandHome(settings.Key))
+		s = openpgpSigner{entity}
+	}
+	if err != nil {
+		return nil, err
+	}
+	signers.m[id] = s
+	return s, nil
+}
+
+// openpgpSigner signs with an OpenPGP key, like gpg --detach-sign --armor.
+type openpgpSigner struct {
+	entity *openpgp.Entity
+}
+
+func (s openpgpSigner) Sign(message io.Reader) ([]byte, error) {
+	var b bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&b, s.entity, message, nil); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// sshSigner signs with an SSH key, like ssh-keygen -Y sign -n git.
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+func (s sshSigner) Sign(message io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(message)
+	if err != nil {
+		return nil, err
+	}
+	return sshsigSign(s.signer, sshsigNamespace, b)
+}
+
+// loadSigningKey reads an OpenPGP private key from an armored or binary
+// keyring file. If the key is protected by a passphrase, the user is
+// prompted for it on the terminal.
+func loadSigningKey(path string) (*openpgp.Entity, error) {
+	entities, err := readKeyRing(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key %s: %w", path, err)
+	}
+	for _, entity := range entities {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if entity.PrivateKey.Encrypted {
+			passphrase, err := promptPassword(fmt.Sprintf("passphrase for %s: ", path))
+			if err != nil {
+				return nil, err
+			}
+			if err := entity.DecryptPrivateKeys(passphrase); err != nil {
+				return nil, fmt.Errorf("decrypting signing key %s: %w", path, err)
+			}
+		}
+		return entity, nil
+	}
+	return nil, errors.New("no private key found in " + path)
+}
+
+// readKeyRing reads an armored or binary OpenPGP keyring.
+func readKeyRing(path string) (openpgp.EntityList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entities, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		if _, serr := f.Seek(0, 0); serr != nil {
+			return nil, serr
+		}
+		return openpgp.ReadKeyRing(f)
+	}
+	return entities, nil
+}
+
+// loadSSHSigningKey loads an SSH signing key. Like git, key may be a private
+// key file, a public key file whose private key is in ssh-agent (or next to
+// it without the .pub suffix), or a literal public key prefixed with key::.
+func loadSSHSigningKey(key string) (ssh.Signer, error) {
+	if literal, ok := strings.CutPrefix(key, "key::"); ok {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(literal))
+		if err != nil {
+			return nil, err
+		}
+		return agentSigner(pub)
+	}
+	path := expandHome(key)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if pub, _, _, _, err := ssh.ParseAuthorizedKey(b); err == nil {
+		if s, err := agentSigner(pub); err == nil {
+			return s, nil
+		}
+		path = strings.TrimSuffix(path, ".pub")
+		if b, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("%s is not in ssh-agent and its private key cannot be read: %w", key, err)
+		}
+	}
+	return parseSSHPrivateKey(path, b)
+}
+
+// parseSSHPrivateKey parses a private key read from path, prompting for its
+// passphrase on the terminal if it is encrypted.
+func parseSSHPrivateKey(path string, b []byte) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(b)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		if err != nil {
+			return nil, fmt.Errorf("reading ssh key %s: %w", path, err)
+		}
+		return signer, nil
+	}
+	passphrase, err := promptPassword(fmt.Sprintf("passphrase for %s: ", path))
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(b, passphrase)
+}
+
+// agentSigner returns the ssh-agent signer for pub.
+func agentSigner(pub ssh.PublicKey) (ssh.Signer, error) {
+	conn, client, err := dialAgent()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	keys, err := client.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), pub.Marshal()) {
+			return agentKey{pub}, nil
+		}
+	}
+	return nil, fmt.Errorf("key %s is not in ssh-agent", ssh.FingerprintSHA256(pub))
+}
+
+// dialAgent connects to the ssh-agent at $SSH_AUTH_SOCK.
+func dialAgent() (net.Conn, agent.ExtendedAgent, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil, errors.New("ssh-agent is not running")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, agent.NewClient(conn), nil
+}
+
+// agentKey signs with a key in ssh-agent. Signers are cached for the whole
+// run, so the agent is connected to for every signature rather than kept
+// open.
+type agentKey struct {
+	pub ssh.PublicKey
+}
+
+func (k agentKey) PublicKey() ssh.PublicKey {
+	return k.pub
+}
+
+func (k agentKey) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return k.SignWithAlgorithm(rand, data, "")
+}
+
+func (k agentKey) SignWithAlgorithm(_ io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	var flags agent.SignatureFlags
+	switch algorithm {
+	case ssh.KeyAlgoRSASHA256:
+		flags = agent.SignatureFlagRsaSha256
+	case ssh.KeyAlgoRSASHA512:
+		flags = agent.SignatureFlagRsaSha512
+	}
+	conn, client, err := dialAgent()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return client.SignWithFlags(k.pub, data, flags)
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
+)
+
+var (
+	snapshotOnBranch bool
+	snapshotCmd      = &cobra.Command{
+		Use:   "snapshot",
+		Short: "record and restore the exact commit of every repo",
+	}
+	snapshotSaveCmd = &cobra.Command{
+		Use:   "save <file>",
+		Short: "record the path, remote, branch and HEAD of every repo",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			var (
+				mutex sync.Mutex
+				state = map[string]parse.SnapshotRepo{}
+			)
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				head, err := r.Head()
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				sr := parse.SnapshotRepo{Path: repo.Path, Remote: repo.Remote, Head: head.Hash().String()}
+				if head.Name().IsBranch() {
+					sr.Branch = head.Name().Short()
+				}
+				mutex.Lock()
+				state[repo.Path] = sr
+				mutex.Unlock()
+				return repoResult{}
+			})
+			for _, res := range results {
+				if res.Err != nil {
+					log.Printf("error reading %s: %s\n", res.Repo, res.Err)
+				}
+			}
+			if err := resultsError(results, "read"); err != nil {
+				return fmt.Errorf("refusing to write an incomplete snapshot: %w", err)
+			}
+			snap := parse.Snapshot{}
+			for _, repo := range conf.Repos {
+				snap.Repos = append(snap.Repos, state[repo.Path])
+			}
+			if dryRun {
+				fmt.Printf("would save %d repos to %s\n", len(snap.Repos), args[0])
+				return nil
+			}
+			if err := snap.Save(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("saved %d repos to %s\n", len(snap.Repos), args[0])
+			return nil
+		},
+	}
+	snapshotRestoreCmd = &cobra.Command{
+		Use:   "restore <file>",
+		Short: "check out the commits recorded in a snapshot",
+		Long: `check out the commits recorded in a snapshot.
+
+Commits that are missing locally are fetched first. Repos are left with a
+detached HEAD unless --branch is passed, in which case the recorded branch is
+checked out and reset to the recorded commit. Repos with uncommitted changes
+are refused.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			snap, err := parse.LoadSnapshot(args[0])
+			if err != nil {
+				return &usageError{err}
+			}
+			// repos in a snapshot need not be registered, but use the
+			// configured credentials when there is a config
+			if conf, err := parse.LoadMGConfig(); err == nil {
+				credentials = newAuthenticator(conf.Auth, conf.KnownHosts)
+			}
+			repos := make([]parse.Repo, len(snap.Repos))
+			for i, sr := range snap.Repos {
+				repos[i] = parse.Repo{Path: sr.Path, Remote: sr.Remote, Branch: sr.Branch}
+			}
+			heads := map[string]plumbing.Hash{}
+			for _, sr := range snap.Repos {
+				heads[sr.Path] = plumbing.NewHash(sr.Head)
+			}
+			results := forEachRepo(cmd.Context(), repos, jobs, func(repo parse.Repo) repoResult {
+				return restoreRepo(repo, heads[repo.Path], snapshotOnBranch)
+			})
+			return printSummary(results, dryRunSummary(summary{Verb: "restore", Past: "restored", Skipped: "already at the recorded commit"}))
+		},
+	}
+	snapshotDiffCmd = &cobra.Command{
+		Use:   "diff <a> <b>",
+		Short: "show which repos moved between two snapshots",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := parse.LoadSnapshot(args[0])
+			if err != nil {
+				return &usageError{err}
+			}
+			b, err := parse.LoadSnapshot(args[1])
+			if err != nil {
+				return &usageError{err}
+			}
+			changes := parse.DiffSnapshots(a, b)
+			for _, c := range changes {
+				switch {
+				case c.Old == nil:
+					fmt.Printf("+ %s: %s\n", c.Path, describeSnapshotRepo(*c.New))
+				case c.New == nil:
+					fmt.Printf("- %s: %s\n", c.Path, describeSnapshotRepo(*c.Old))
+				default:
+					fmt.Printf("~ %s: %s -> %s\n", c.Path, describeSnapshotRepo(*c.Old), describeSnapshotRepo(*c.New))
+				}
+			}
+			if len(changes) > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%d repos changed\n", len(changes))
+			return nil
+		},
+	}
+)
+
+func describeSnapshotRepo(sr parse.SnapshotRepo) string {
+	head := sr.Head
+	if len(head) > 7 {
+		head = head[:7]
+	}
+	if sr.Branch == "" {
+		return head + " (detached)"
+	}
+	return fmt.Sprintf("%s (%s)", head, sr.Branch)
+}
+
+// restoreRepo checks out hash in the repo, fetching it if it is missing.
+// When onBranch is set the repo's branch is checked out and reset to hash
+// instead of detaching HEAD. With --dry-run it only prints the plan.
+func restoreRepo(repo parse.Repo, hash plumbing.Hash, onBranch bool) repoResult {
+	r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	onBranch = onBranch && repo.Branch != ""
+	branch := plumbing.NewBranchReferenceName(repo.Branch)
+	head, err := r.Head()
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	if head.Hash() == hash && (!onBranch || head.Name() == branch) {
+		repoPrintf(repo.Path, "repo %s: already at %s\n", repo.Path, hash.String()[:7])
+		return repoResult{Skipped: true}
+	}
+	st, err := w.Status()
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	if hasChanges(st) {
+		return repoResult{Err: errDirtyWorktree}
+	}
+	if dryRun {
+		plan := fmt.Sprintf("repo %s: would restore to %s", repo.Path, hash.String()[:7])
+		if onBranch {
+			plan += " on " + repo.Branch
+		}
+		if _, err := r.CommitObject(hash); errors.Is(err, plumbing.ErrObjectNotFound) {
+			plan += " after fetching it"
+		} else if err != nil {
+			return repoResult{Err: err}
+		}
+		repoPrintf(repo.Path, "%s\n", plan)
+		return repoResult{}
+	}
+	if _, err := r.CommitObject(hash); errors.Is(err, plumbing.ErrObjectNotFound) {
+		repoLogf(repo.Path, "fetching missing commit in %s\n", repo.Path)
+		auth, err := remoteAuth(r, git.DefaultRemoteName)
+		if err != nil {
+			return repoResult{Err: err}
+		}
+		setPhase(repo.Path, "fetching")
+		err = r.Fetch(&git.FetchOptions{Auth: auth, Progress: sideband(repo.Path)})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return repoResult{Err: err}
+		}
+		if _, err := r.CommitObject(hash); err != nil {
+			return repoResult{Err: fmt.Errorf("commit %s: %w", hash, err)}
+		}
+	} else if err != nil {
+		return repoResult{Err: err}
+	}
+
+	if !onBranch {
+		if err := w.Checkout(&git.CheckoutOptions{Hash: hash}); err != nil {
+			return repoResult{Err: err}
+		}
+		repoPrintf(repo.Path, "restored %s to %s\n", repo.Path, hash.String()[:7])
+		return repoResult{}
+	}
+	opts := &git.CheckoutOptions{Branch: branch}
+	if _, err := r.Reference(branch, false); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		opts.Create = true
+		opts.Hash = hash
+	}
+	if err := w.Checkout(opts); err != nil {
+		return repoResult{Err: err}
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: hash, Mode: git.MergeReset}); err != nil {
+		return repoResult{Err: err}
+	}
+	repoPrintf(repo.Path, "restored %s to %s on %s\n", repo.Path, hash.String()[:7], repo.Branch)
+	return repoResult{}
+}
+
+func init() {
+	RootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotSaveCmd, snapshotRestoreCmd, snapshotDiffCmd)
+	snapshotSaveCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	snapshotRestoreCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	snapshotRestoreCmd.Flags().BoolVarP(&snapshotOnBranch, "branch", "b", false, "check out the recorded branch and reset it instead of detaching HEAD")
+}
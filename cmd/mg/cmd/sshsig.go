@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH signatures as described in OpenSSH's PROTOCOL.sshsig, the format git
+// uses for gpg.format=ssh.
+const (
+	sshsigMagic     = "SSHSIG"
+	sshsigVersion   = 1
+	sshsigNamespace = "git"
+	sshsigBegin     = "-----BEGIN SSH SIGNATURE-----"
+	sshsigEnd       = "-----END SSH SIGNATURE-----"
+)
+
+var errBadSignature = errors.New("bad signature")
+
+// sshsigBlob is the body of an SSH signature following the magic preamble.
+type sshsigBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshsigSignedData is what is actually signed, following the magic preamble.
+type sshsigSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// sshsigSign signs message in namespace and returns the armored signature.
+func sshsigSign(signer ssh.Signer, namespace string, message []byte) ([]byte, error) {
+	data := sshsigData(namespace, "sha512", sha512.New, message)
+	var (
+		sig *ssh.Signature
+		err error
+	)
+	// RSA keys must not sign with SHA-1
+	if as, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = as.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	blob := append([]byte(sshsigMagic), ssh.Marshal(sshsigBlob{
+		Version:       sshsigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig),
+	})...)
+
+	var b bytes.Buffer
+	b.WriteString(sshsigBegin + "\n")
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	for len(encoded) > 70 {
+		b.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	b.WriteString(encoded + "\n" + sshsigEnd + "\n")
+	return b.Bytes(), nil
+}
+
+// sshsigVerify checks an armored SSH signature of message in namespace and
+// returns the public key that made it.
+func sshsigVerify(armored []byte, namespace string, message []byte) (ssh.PublicKey, error) {
+	body := strings.TrimSpace(string(armored))
+	body, ok := strings.CutPrefix(body, sshsigBegin)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an SSH signature", errBadSignature)
+	}
+	body, ok = strings.CutSuffix(body, sshsigEnd)
+	if !ok {
+		return nil, fmt.Errorf("%w: truncated SSH signature", errBadSignature)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadSignature, err)
+	}
+	rest, ok := bytes.CutPrefix(raw, []byte(sshsigMagic))
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s preamble", errBadSignature, sshsigMagic)
+	}
+	var blob sshsigBlob
+	if err := ssh.Unmarshal(rest, &blob); err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadSignature, err)
+	}
+	if blob.Version != sshsigVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", errBadSignature, blob.Version)
+	}
+	if blob.Namespace != namespace {
+		return nil, fmt.Errorf("%w: signed for namespace %q, not %q", errBadSignature, blob.Namespace, namespace)
+	}
+	var newHash func() hash.Hash
+	switch blob.HashAlgorithm {
+	case "sha256":
+		newHash = sha256.New
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("%w: unsupported hash %q", errBadSignature, blob.HashAlgorithm)
+	}
+	pub, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadSignature, err)
+	}
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(blob.Signature, &sig); err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadSignature, err)
+	}
+	data := sshsigData(blob.Namespace, blob.HashAlgorithm, newHash, message)
+	if err := pub.Verify(data, &sig); err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadSignature, err)
+	}
+	return pub, nil
+}
+
+// sshsigData builds the data that is signed for message.
+func sshsigData(namespace, hashAlgorithm string, newHash func() hash.Hash, message []byte) []byte {
+	h := newHash()
+	h.Write(message)
+	return append([]byte(sshsigMagic), ssh.Marshal(sshsigSignedData{
+		Namespace:     namespace,
+		HashAlgorithm: hashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...)
+}
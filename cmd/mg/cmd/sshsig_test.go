@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func testSSHKey(t *testing.T) (ed25519.PrivateKey, ssh.Signer) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, signer
+}
+
+func TestSSHSig_SignVerify(t *testing.T) {
+	_, signer := testSSHKey(t)
+	message := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\ninitial commit\n")
+	sig, err := sshsigSign(signer, sshsigNamespace, message)
+	if err != nil {
+		t.Fatalf("sshsigSign() unexpected error: %v", err)
+	}
+	if !bytes.HasPrefix(sig, []byte(sshsigBegin+"\n")) {
+		t.Errorf("expected an armored signature, got %q", sig)
+	}
+	pub, err := sshsigVerify(sig, sshsigNamespace, message)
+	if err != nil {
+		t.Fatalf("sshsigVerify() unexpected error: %v", err)
+	}
+	if !bytes.Equal(pub.Marshal(), signer.PublicKey().Marshal()) {
+		t.Error("expected the signing key to be returned")
+	}
+
+	if _, err := sshsigVerify(sig, sshsigNamespace, append(message, '!')); !errors.Is(err, errBadSignature) {
+		t.Errorf("expected a changed message to fail, got %v", err)
+	}
+	if _, err := sshsigVerify(sig, "file", message); !errors.Is(err, errBadSignature) {
+		t.Errorf("expected another namespace to fail, got %v", err)
+	}
+	if _, err := sshsigVerify([]byte("-----BEGIN PGP SIGNATURE-----"), sshsigNamespace, message); !errors.Is(err, errBadSignature) {
+		t.Errorf("expected a non-SSH signature to fail, got %v", err)
+	}
+}
+
+func TestAgentSigner(t *testing.T) {
+	priv, signer := testSSHKey(t)
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	closed := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				// returns once mg closes the connection
+				agent.ServeAgent(keyring, conn)
+				conn.Close()
+				closed <- struct{}{}
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	key, err := loadSSHSigningKey("key::" + string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	if err != nil {
+		t.Fatalf("loadSSHSigningKey() unexpected error: %v", err)
+	}
+	message := []byte("signed by the agent\n")
+	sig, err := sshsigSign(key, sshsigNamespace, message)
+	if err != nil {
+		t.Fatalf("sshsigSign() unexpected error: %v", err)
+	}
+	if _, err := sshsigVerify(sig, sshsigNamespace, message); err != nil {
+		t.Errorf("sshsigVerify() unexpected error: %v", err)
+	}
+	// one connection to find the key and one to sign
+	for range 2 {
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected every connection to the agent to be closed")
+		}
+	}
+
+	_, other := testSSHKey(t)
+	if _, err := agentSigner(other.PublicKey()); err == nil {
+		t.Error("expected an error for a key that is not in the agent")
+	}
+}
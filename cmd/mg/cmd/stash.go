@@ -0,0 +1,582 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
+)
+
+const stashRef = plumbing.ReferenceName("refs/stash")
+
+var (
+	stashMessage string
+	stashID      string
+	stashCmd     = &cobra.Command{
+		Use:   "stash",
+		Short: "shelve uncommitted changes across all repos",
+	}
+	stashPushCmd = &cobra.Command{
+		Use:   "push",
+		Short: "stash uncommitted changes to tracked files in every repo",
+		Long: `stash uncommitted changes to tracked files in every repo.
+
+Every stash created by one run of mg stash push carries the same id in its
+message, so mg stash pop only restores the stashes created together.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			id := time.Now().UTC().Format("20060102T150405.000")
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if dryRun {
+					return stashPlan(r, repo.Path)
+				}
+				stashed, err := stashPush(r, stashMessage, id)
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if !stashed {
+					repoPrintf(repo.Path, "repo %s: no local changes to stash\n", repo.Path)
+					return repoResult{Skipped: true}
+				}
+				repoPrintf(repo.Path, "stashed changes in %s\n", repo.Path)
+				return repoResult{}
+			})
+			err = printSummary(results, dryRunSummary(summary{Verb: "stash", Past: "stashed", Skipped: "had no local changes"}))
+			if !dryRun {
+				fmt.Printf("stash id: %s\n", id)
+			}
+			return err
+		},
+	}
+	stashListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "list the stashes of every repo",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			stashes, results := readAllStashes(cmd.Context(), conf.Repos)
+			total := 0
+			for _, repo := range conf.Repos {
+				entries := stashes[repo.Path]
+				if len(entries) == 0 {
+					continue
+				}
+				total += len(entries)
+				fmt.Printf("%s:\n", repo.Path)
+				for i, entry := range entries {
+					fmt.Printf("  stash@{%d}: %s\n", i, entry.Message)
+				}
+				fmt.Println()
+			}
+			for _, res := range results {
+				if res.Err != nil {
+					log.Printf("error reading %s: %s\n", res.Repo, res.Err)
+				}
+			}
+			fmt.Printf("%d stashes\n", total)
+			return resultsError(results, "read")
+		},
+	}
+	stashPopCmd = &cobra.Command{
+		Use:   "pop",
+		Short: "restore the stashes created by the last mg stash push",
+		Long: `restore the stashes created by the last mg stash push.
+
+Only stashes carrying the id of a single mg stash push are popped; by default
+this is the most recent one found in any repo. If a stashed file was also
+changed in the current HEAD the stash is kept and the conflicting files are
+reported instead.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			id := stashID
+			if id == "" {
+				stashes, _ := readAllStashes(cmd.Context(), conf.Repos)
+				for _, entries := range stashes {
+					for _, entry := range entries {
+						if entry.ID > id {
+							id = entry.ID
+						}
+					}
+				}
+				if id == "" {
+					return errors.New("no stashes created by mg found")
+				}
+			}
+			var (
+				mutex     sync.Mutex
+				conflicts = map[string][]string{}
+			)
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				found, files, err := stashPop(r, id)
+				if len(files) > 0 {
+					mutex.Lock()
+					conflicts[repo.Path] = files
+					mutex.Unlock()
+				}
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if !found {
+					repoPrintf(repo.Path, "repo %s: no stash %s\n", repo.Path, id)
+					return repoResult{Skipped: true}
+				}
+				if dryRun {
+					repoPrintf(repo.Path, "repo %s: would pop stash %s\n", repo.Path, id)
+					return repoResult{}
+				}
+				repoPrintf(repo.Path, "popped stash in %s\n", repo.Path)
+				return repoResult{}
+			})
+			for _, repo := range conf.Repos {
+				files := conflicts[repo.Path]
+				if len(files) == 0 {
+					continue
+				}
+				fmt.Printf("%s: conflicts, stash kept\n", repo.Path)
+				for _, file := range files {
+					fmt.Printf("  C %s\n", file)
+				}
+				fmt.Println()
+			}
+			return printSummary(results, dryRunSummary(summary{Verb: "pop stash in", Past: "popped stash in", Skipped: "had no matching stash"}))
+		},
+	}
+)
+
+var (
+	errStashConflict = errors.New("stashed changes conflict with HEAD")
+	stashMarker      = regexp.MustCompile(`\[mg:([^\]]+)\]`)
+)
+
+// stashEntry is a single stash, read from the reflog of refs/stash.
+// ID is the id of the mg stash push that created it, if any.
+type stashEntry struct {
+	Hash    plumbing.Hash
+	Message string
+	ID      string
+	line    string
+}
+
+// readAllStashes reads the stashes of every repo, newest first.
+func readAllStashes(ctx context.Context, repos []parse.Repo) (map[string][]stashEntry, []repoResult) {
+	var (
+		mutex   sync.Mutex
+		stashes = map[string][]stashEntry{}
+	)
+	results := forEachRepo(ctx, repos, jobs, func(repo parse.Repo) repoResult {
+		r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+		if err != nil {
+			return repoResult{Err: err}
+		}
+		entries, err := readStashes(r)
+		if err != nil {
+			return repoResult{Err: err}
+		}
+		mutex.Lock()
+		stashes[repo.Path] = entries
+		mutex.Unlock()
+		return repoResult{}
+	})
+	return stashes, results
+}
+
+// gitDir returns the filesystem of the repository's .git directory.
+func gitDir(r *git.Repository) (billy.Filesystem, error) {
+	s, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, errors.New("repository is not stored on disk")
+	}
+	return s.Filesystem(), nil
+}
+
+// readStashes returns the stashes of r, newest first, in the same order as
+// git stash list.
+func readStashes(r *git.Repository) ([]stashEntry, error) {
+	fs, err := gitDir(r)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fs.Open(fs.Join("logs", stashRef.String()))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries := []stashEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		header, message, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(header)
+		if !ok || len(fields) < 2 {
+			continue
+		}
+		entry := stashEntry{Hash: plumbing.NewHash(fields[1]), Message: message, line: line}
+		if m := stashMarker.FindStringSubmatch(message); m != nil {
+			entry.ID = m[1]
+		}
+		entries = append([]stashEntry{entry}, entries...)
+	}
+	return entries, scanner.Err()
+}
+
+// writeStashes replaces the reflog of refs/stash with entries (newest first)
+// and points refs/stash at the newest one.
+func writeStashes(r *git.Repository, entries []stashEntry) error {
+	fs, err := gitDir(r)
+	if err != nil {
+		return err
+	}
+	logPath := fs.Join("logs", stashRef.String())
+	if len(entries) == 0 {
+		if err := fs.Remove(logPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.Storer.RemoveReference(stashRef)
+	}
+	f, err := fs.Create(logPath)
+	if err != nil {
+		return err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if _, err := io.WriteString(f, entries[i].line+"\n"); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return r.Storer.SetReference(plumbing.NewHashReference(stashRef, entries[0].Hash))
+}
+
+// stashPush saves the index and the changes to tracked files the same way
+// git stash does, then resets the worktree to HEAD. It returns false if
+// there was nothing to stash.
+func stashPush(r *git.Repository, message, id string) (bool, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return false, err
+	}
+	st, err := w.Status()
+	if err != nil {
+		return false, err
+	}
+	if !hasChanges(st) {
+		return false, nil
+	}
+	head, err := r.Head()
+	if err != nil {
+		return false, err
+	}
+	headCommit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return false, err
+	}
+	branch := "(no branch)"
+	if head.Name().IsBranch() {
+		branch = head.Name().Short()
+	}
+	if message == "" {
+		subject, _, _ := strings.Cut(headCommit.Message, "\n")
+		message = fmt.Sprintf("%s %s", head.Hash().String()[:7], subject)
+	}
+	message = fmt.Sprintf("On %s: %s [mg:%s]", branch, message, id)
+
+	// Commit moves HEAD, so always put it back where it was.
+	restoreHead := func() error {
+		return r.Storer.SetReference(plumbing.NewHashReference(head.Name(), head.Hash()))
+	}
+	index, err := w.Commit("index on "+branch, &git.CommitOptions{
+		Parents:           []plumbing.Hash{head.Hash()},
+		AllowEmptyCommits: true,
+	})
+	if err != nil {
+		return false, errors.Join(err, restoreHead())
+	}
+	stash, err := w.Commit(message, &git.CommitOptions{
+		All:               true,
+		Parents:           []plumbing.Hash{head.Hash(), index},
+		AllowEmptyCommits: true,
+	})
+	if err != nil {
+		return false, errors.Join(err, restoreHead())
+	}
+	if err := restoreHead(); err != nil {
+		return false, err
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.MergeReset}); err != nil {
+		return false, err
+	}
+
+	stashCommit, err := r.CommitObject(stash)
+	if err != nil {
+		return false, err
+	}
+	entries, err := readStashes(r)
+	if err != nil {
+		return false, err
+	}
+	previous := plumbing.ZeroHash
+	if len(entries) > 0 {
+		previous = entries[0].Hash
+	}
+	sig := stashCommit.Committer
+	line := fmt.Sprintf("%s %s %s <%s> %d %s\t%s", previous, stash, sig.Name, sig.Email,
+		sig.When.Unix(), sig.When.Format("-0700"), message)
+	entries = append([]stashEntry{{Hash: stash, Message: message, ID: id, line: line}}, entries...)
+	return true, writeStashes(r, entries)
+}
+
+// stashPlan prints the changed files stashing would save in r.
+func stashPlan(r *git.Repository, path string) repoResult {
+	w, err := r.Worktree()
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	st, err := w.Status()
+	if err != nil {
+		return repoResult{Err: err}
+	}
+	var lines []string
+	for file, s := range st {
+		if s.Staging == git.Untracked || (s.Staging == git.Unmodified && s.Worktree == git.Unmodified) {
+			continue
+		}
+		lines = append(lines, "  "+file)
+	}
+	if len(lines) == 0 {
+		repoPrintf(path, "repo %s: no local changes to stash\n", path)
+		return repoResult{Skipped: true}
+	}
+	sort.Strings(lines)
+	repoPrintf(path, "repo %s: would stash\n%s\n", path, strings.Join(lines, "\n"))
+	return repoResult{}
+}
+
+// stashPop applies and drops the stash created by the mg stash push with the
+// given id. It reports whether such a stash was found, and the conflicting
+// files if the stash could not be applied cleanly. With --dry-run nothing is
+// applied or dropped.
+func stashPop(r *git.Repository, id string) (bool, []string, error) {
+	entries, err := readStashes(r)
+	if err != nil {
+		return false, nil, err
+	}
+	pos := -1
+	for i, entry := range entries {
+		if entry.ID == id {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return false, nil, nil
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return true, nil, err
+	}
+	st, err := w.Status()
+	if err != nil {
+		return true, nil, err
+	}
+	if hasChanges(st) {
+		return true, nil, errDirtyWorktree
+	}
+
+	stash, err := r.CommitObject(entries[pos].Hash)
+	if err != nil {
+		return true, nil, err
+	}
+	if stash.NumParents() < 1 {
+		return true, nil, errors.New("malformed stash commit " + stash.Hash.String())
+	}
+	base, err := stash.Parent(0)
+	if err != nil {
+		return true, nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return true, nil, err
+	}
+	headCommit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return true, nil, err
+	}
+	trees := make([]*object.Tree, 3)
+	for i, c := range []*object.Commit{base, stash, headCommit} {
+		if trees[i], err = c.Tree(); err != nil {
+			return true, nil, err
+		}
+	}
+	baseTree, stashTree, headTree := trees[0], trees[1], trees[2]
+	changes, err := object.DiffTree(baseTree, stashTree)
+	if err != nil {
+		return true, nil, err
+	}
+
+	root := w.Filesystem.Root()
+	paths := map[string]bool{}
+	for _, change := range changes {
+		if change.From.Name != "" {
+			paths[change.From.Name] = true
+		}
+		if change.To.Name != "" {
+			paths[change.To.Name] = true
+		}
+	}
+	apply, conflicts := []string{}, []string{}
+	for path := range paths {
+		baseEntry := treeEntry(baseTree, path)
+		stashed := treeEntry(stashTree, path)
+		headEntry := treeEntry(headTree, path)
+		switch {
+		case sameEntry(headEntry, stashed):
+			// HEAD already has the stashed version
+		case sameEntry(headEntry, baseEntry):
+			if headEntry == nil && stashed != nil {
+				// a new file must not overwrite an untracked one
+				if _, err := os.Lstat(filepath.Join(root, path)); err == nil {
+					conflicts = append(conflicts, path)
+					continue
+				}
+			}
+			apply = append(apply, path)
+		default:
+			conflicts = append(conflicts, path)
+		}
+	}
+	sort.Strings(conflicts)
+	if len(conflicts) > 0 {
+		return true, conflicts, errStashConflict
+	}
+
+	if dryRun {
+		return true, nil, nil
+	}
+	for _, path := range apply {
+		if err := restoreFile(w, stashTree, baseTree, path); err != nil {
+			return true, nil, err
+		}
+	}
+	entries = append(entries[:pos], entries[pos+1:]...)
+	return true, nil, writeStashes(r, entries)
+}
+
+// restoreFile writes the version of path in tree to the worktree, removing
+// it if it does not exist in tree. Files that are new compared to base are
+// added to the index so they stay tracked.
+func restoreFile(w *git.Worktree, tree, base *object.Tree, path string) error {
+	full := filepath.Join(w.Filesystem.Root(), path)
+	entry := treeEntry(tree, path)
+	if entry == nil {
+		if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	file, err := tree.TreeEntryFile(entry)
+	if err != nil {
+		return err
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	switch entry.Mode {
+	case filemode.Symlink:
+		err = os.Symlink(contents, full)
+	case filemode.Executable:
+		err = os.WriteFile(full, []byte(contents), 0o755)
+	default:
+		err = os.WriteFile(full, []byte(contents), 0o644)
+	}
+	if err != nil {
+		return err
+	}
+	if treeEntry(base, path) == nil {
+		_, err = w.Add(path)
+	}
+	return err
+}
+
+// treeEntry returns the entry for path in tree, or nil if there is none.
+func treeEntry(tree *object.Tree, path string) *object.TreeEntry {
+	entry, err := tree.FindEntry(path)
+	if err != nil {
+		return nil
+	}
+	return entry
+}
+
+func sameEntry(a, b *object.TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+func init() {
+	RootCmd.AddCommand(stashCmd)
+	stashCmd.AddCommand(stashPushCmd, stashListCmd, stashPopCmd)
+	for _, c := range stashCmd.Commands() {
+		c.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	}
+	stashPushCmd.Flags().StringVarP(&stashMessage, "message", "m", "", "stash message")
+	stashPopCmd.Flags().StringVar(&stashID, "id", "", "id of the mg stash push to pop (defaults to the latest)")
+}
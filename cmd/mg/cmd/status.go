@@ -3,12 +3,13 @@ package cmd
 import (
 	"fmt"
 	"log"
-	"os"
 	"sort"
 	"sync"
 
 	git "github.com/go-git/go-git/v5"
 	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
 )
 
 type repoStatus struct {
@@ -25,88 +26,58 @@ type repoStatus struct {
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "get the combined git status for all git repos",
-	Run: func(_ *cobra.Command, args []string) {
-		type RepoError struct {
-			Error error
-			Repo  string
-		}
-		if jobs < 1 {
-			log.Println("jobs must be greater than 0")
-			os.Exit(1)
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if err := checkJobs(); err != nil {
+			return err
 		}
-		conf := GetConfig()
-		if len(args) > 0 {
-			log.Println("too many arguments")
-			os.Exit(1)
+		conf, err := GetConfig()
+		if err != nil {
+			return err
 		}
-		repoChan := make(chan string, len(conf.Repos))
 		var (
-			errs     []RepoError
 			statuses []repoStatus
 			mutex    sync.Mutex
-			wg       sync.WaitGroup
 		)
-		wg.Add(len(conf.Repos))
-		for i := 0; i < jobs; i++ {
-			go func() {
-				for repo := range repoChan {
-					r, err := git.PlainOpenWithOptions(repo, &git.PlainOpenOptions{DetectDotGit: true})
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						wg.Done()
-						continue
-					}
-					w, err := r.Worktree()
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						wg.Done()
-						continue
-					}
-					st, err := w.Status()
-					if err != nil {
-						mutex.Lock()
-						errs = append(errs, RepoError{Error: err, Repo: repo})
-						mutex.Unlock()
-						wg.Done()
-						continue
-					}
-					rs := repoStatus{Path: repo, Clean: st.IsClean()}
-					for _, s := range st {
-						code := s.Worktree
-						if code == git.Unmodified {
-							code = s.Staging
-						}
-						switch code {
-						case git.Modified:
-							rs.Modified++
-						case git.Added:
-							rs.Added++
-						case git.Deleted:
-							rs.Deleted++
-						case git.Renamed:
-							rs.Renamed++
-						case git.Copied:
-							rs.Copied++
-						case git.Untracked:
-							rs.Untrack++
-						}
-					}
-					mutex.Lock()
-					statuses = append(statuses, rs)
-					mutex.Unlock()
-					wg.Done()
+		results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+			r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			w, err := r.Worktree()
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			st, err := w.Status()
+			if err != nil {
+				return repoResult{Err: err}
+			}
+			rs := repoStatus{Path: repo.Path, Clean: st.IsClean()}
+			for _, s := range st {
+				code := s.Worktree
+				if code == git.Unmodified {
+					code = s.Staging
 				}
-			}()
-		}
-		for _, repo := range conf.Repos {
-			repoChan <- repo.Path
-		}
-		close(repoChan)
-		wg.Wait()
+				switch code {
+				case git.Modified:
+					rs.Modified++
+				case git.Added:
+					rs.Added++
+				case git.Deleted:
+					rs.Deleted++
+				case git.Renamed:
+					rs.Renamed++
+				case git.Copied:
+					rs.Copied++
+				case git.Untracked:
+					rs.Untrack++
+				}
+			}
+			mutex.Lock()
+			statuses = append(statuses, rs)
+			mutex.Unlock()
+			return repoResult{Skipped: rs.Clean}
+		})
 
 		sort.Slice(statuses, func(i, j int) bool {
 			return statuses[i].Path < statuses[j].Path
@@ -139,15 +110,20 @@ var statusCmd = &cobra.Command{
 			}
 		}
 
-		for _, err := range errs {
-			log.Printf("error reading %s: %s\n", err.Repo, err.Error)
+		failed := 0
+		for _, res := range results {
+			if res.Err != nil {
+				failed++
+				log.Printf("error reading %s: %s\n", res.Repo, res.Err)
+			}
 		}
 
 		fmt.Println()
-		fmt.Printf("%d/%d repos have uncommitted changes\n", dirtyCount, len(conf.Repos))
-		if len(errs) > 0 {
-			fmt.Printf("failed to read %d/%d repos\n", len(errs), len(conf.Repos))
+		fmt.Printf("%d/%d repos have uncommitted changes\n", dirtyCount, len(results))
+		if failed > 0 {
+			fmt.Printf("failed to read %d/%d repos\n", failed, len(results))
 		}
+		return reportResults(results, summary{Verb: "read", Skipped: "clean"})
 	},
 }
 
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
+)
+
+var (
+	tagAnnotate bool
+	tagMessage  string
+	tagSign     bool
+	tagSignKey  string
+	tagPush     bool
+	tagCmd      = &cobra.Command{
+		Use:   "tag <name>",
+		Short: "create the same tag at HEAD across all repos",
+		Long: `create the same tag at HEAD across all repos.
+
+Before anything is tagged, every repo is checked: if any repo has uncommitted
+changes or already has the tag, no repo is tagged. With --push only the new tag
+is pushed to each repo's remote. --dry-run runs the same checks and shows the
+commit each repo would tag. When mg retry reruns a tag --push whose push
+failed, repos that already have the tag at HEAD are not tagged again but
+pushed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			name := args[0]
+			// like git, a message or signature implies an annotated tag
+			annotate := tagAnnotate || tagMessage != "" || tagSign
+			if annotate && tagMessage == "" {
+				return usageErrorf("annotated tags require a message (-m)")
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+
+			// resolving the signer up front also asks for any passphrase
+			// before anything is tagged
+			preflight := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				// a retry reruns the whole command, including tagging the
+				// repos whose push failed after they were tagged
+				tagged, err := checkTaggable(repo.Path, name, tagPush && len(onlyRepos) > 0)
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if tagged || !tagSign {
+					return repoResult{Skipped: tagged}
+				}
+				_, err = repoSigner(repo.Path, conf.Signing, tagSignKey)
+				return repoResult{Err: err}
+			})
+			for _, res := range preflight {
+				if res.Err != nil {
+					log.Printf("cannot tag %s: %s\n", res.Repo, res.Err)
+				}
+			}
+			if err := resultsError(preflight, "check"); err != nil {
+				return fmt.Errorf("refusing to tag: %w", err)
+			}
+			tagged := map[string]bool{}
+			for _, res := range preflight {
+				tagged[res.Repo] = res.Skipped
+			}
+
+			results := forEachRepoInOrder(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				if tagged[repo.Path] {
+					repoPrintf(repo.Path, "repo %s: already tagged %s at HEAD\n", repo.Path, name)
+					return repoResult{Skipped: true}
+				}
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				head, err := r.Head()
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				if dryRun {
+					plan := fmt.Sprintf("repo %s: would tag %s as %s", repo.Path, head.Hash().String()[:7], name)
+					if tagPush {
+						plan += " and push it"
+					}
+					repoPrintf(repo.Path, "%s\n", plan)
+					return repoResult{}
+				}
+				if tagSign {
+					signer, err := repoSigner(repo.Path, conf.Signing, tagSignKey)
+					if err != nil {
+						return repoResult{Err: err}
+					}
+					if err := createSignedTag(r, name, head.Hash(), tagMessage, signer); err != nil {
+						return repoResult{Err: err}
+					}
+					repoPrintf(repo.Path, "tagged %s as %s\n", repo.Path, name)
+					return repoResult{}
+				}
+				var opts *git.CreateTagOptions
+				if annotate {
+					opts = &git.CreateTagOptions{Message: tagMessage}
+				}
+				if _, err := r.CreateTag(name, head.Hash(), opts); err != nil {
+					return repoResult{Err: err}
+				}
+				repoPrintf(repo.Path, "tagged %s as %s\n", repo.Path, name)
+				return repoResult{}
+			})
+			tagErr := printSummary(results, dryRunSummary(summary{Verb: "tag", Past: "tagged", Skipped: "already tagged"}))
+			if !tagPush || dryRun {
+				return tagErr
+			}
+
+			ok := map[string]bool{}
+			for _, res := range results {
+				ok[res.Repo] = res.Err == nil
+			}
+			toPush := []parse.Repo{}
+			for _, repo := range conf.Repos {
+				if ok[repo.Path] {
+					toPush = append(toPush, repo)
+				}
+			}
+			refSpec := config.RefSpec(fmt.Sprintf("refs/tags/%s:refs/tags/%s", name, name))
+			results = forEachRepoInOrder(cmd.Context(), toPush, jobs, func(repo parse.Repo) repoResult {
+				repoLogf(repo.Path, "attempting push: %s\n", repo.Path)
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				auth, err := remoteAuth(r, git.DefaultRemoteName)
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				setPhase(repo.Path, "pushing")
+				err = r.PushContext(cmd.Context(), &git.PushOptions{RefSpecs: []config.RefSpec{refSpec}, Auth: auth, Progress: sideband(repo.Path)})
+				if err == git.NoErrAlreadyUpToDate {
+					repoPrintf(repo.Path, "repo %s: already up to date\n", repo.Path)
+					return repoResult{Skipped: true}
+				} else if err != nil {
+					return repoResult{Err: err}
+				}
+				repoPrintf(repo.Path, "successfully pushed %s\n", repo.Path)
+				return repoResult{}
+			})
+			if err := printSummary(results, summary{Verb: "push", Past: "pushed", Skipped: "already up to date"}); err != nil {
+				return err
+			}
+			return tagErr
+		},
+	}
+)
+
+// checkTaggable returns an error if the repo at path has uncommitted changes
+// or already has a tag called name. With atHead, a tag called name that
+// already points at HEAD is accepted, and reported as tagged.
+func checkTaggable(path, name string, atHead bool) (bool, error) {
+	r, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return false, err
+	}
+	if ref, err := r.Tag(name); err == nil {
+		if !atHead {
+			return false, fmt.Errorf("tag %s already exists", name)
+		}
+		return true, checkTagAtHead(r, ref)
+	} else if !errors.Is(err, git.ErrTagNotFound) {
+		return false, err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return false, err
+	}
+	st, err := w.Status()
+	if err != nil {
+		return false, err
+	}
+	if hasChanges(st) {
+		return false, errDirtyWorktree
+	}
+	return false, nil
+}
+
+// checkTagAtHead returns an error unless the tag at ref points at HEAD.
+func checkTagAtHead(r *git.Repository, ref *plumbing.Reference) error {
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+	target := ref.Hash()
+	if t, err := r.TagObject(target); err == nil {
+		target = t.Target
+	} else if !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return err
+	}
+	if target != head.Hash() {
+		return fmt.Errorf("tag %s already exists at %s, not at HEAD", ref.Name().Short(), target.String()[:7])
+	}
+	return nil
+}
+
+// createSignedTag creates an annotated tag signed by signer. go-git's
+// CreateTag can only sign with OpenPGP keys, so the tag object is built here.
+func createSignedTag(r *git.Repository, name string, hash plumbing.Hash, message string, signer git.Signer) error {
+	tagger, err := commitIdentity(r)
+	if err != nil {
+		return err
+	}
+	target, err := r.Storer.EncodedObject(plumbing.AnyObject, hash)
+	if err != nil {
+		return err
+	}
+	tag := &object.Tag{
+		Name:       name,
+		Tagger:     *tagger,
+		Message:    strings.TrimSpace(message) + "\n",
+		TargetType: target.Type(),
+		Target:     hash,
+	}
+	unsigned := &plumbing.MemoryObject{}
+	if err := tag.Encode(unsigned); err != nil {
+		return err
+	}
+	reader, err := unsigned.Reader()
+	if err != nil {
+		return err
+	}
+	sig, err := signer.Sign(reader)
+	if err != nil {
+		return err
+	}
+	tag.PGPSignature = string(sig)
+	obj := r.Storer.NewEncodedObject()
+	if err := tag.Encode(obj); err != nil {
+		return err
+	}
+	tagHash, err := r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return err
+	}
+	return r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName(name), tagHash))
+}
+
+func init() {
+	RootCmd.AddCommand(tagCmd)
+	tagCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	tagCmd.Flags().BoolVarP(&tagAnnotate, "annotate", "a", false, "create an annotated tag")
+	tagCmd.Flags().StringVarP(&tagMessage, "message", "m", "", "tag message (implies -a)")
+	tagCmd.Flags().BoolVarP(&tagSign, "sign", "s", false, "create a signed tag (implies -a)")
+	tagCmd.Flags().StringVar(&tagSignKey, "sign-key", "", "OpenPGP keyring or SSH key to sign with, instead of the configured key")
+	tagCmd.Flags().BoolVar(&tagPush, "push", false, "push the new tag to each repo's remote")
+}
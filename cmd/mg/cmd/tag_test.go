@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestCheckTaggable(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "Alice", Email: "alice@example.com"}
+	first, err := w.Commit("first", &git.CommitOptions{AllowEmptyCommits: true, Author: sig, Committer: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.CreateTag("v1", first, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := checkTaggable(dir, "v1", false); err == nil {
+		t.Error("expected an existing tag to be refused")
+	}
+	tagged, err := checkTaggable(dir, "v1", true)
+	if err != nil || !tagged {
+		t.Errorf("expected a retry to accept the tag at HEAD, got %v, %v", tagged, err)
+	}
+	tagged, err = checkTaggable(dir, "v2", true)
+	if err != nil || tagged {
+		t.Errorf("expected a new tag to be taggable, got %v, %v", tagged, err)
+	}
+
+	if _, err := w.Commit("second", &git.CommitOptions{AllowEmptyCommits: true, Author: sig, Committer: sig}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkTaggable(dir, "v1", true); err == nil {
+		t.Error("expected a retry to refuse a tag that is not at HEAD")
+	}
+}
@@ -1,57 +1,54 @@
 package cmd
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"os"
 
 	git "github.com/go-git/go-git/v5"
 	"github.com/spf13/cobra"
+
+	"github.com/taigrr/mg/parse"
 )
 
 // unregisterCmd represents the unregister command
 var unregisterCmd = &cobra.Command{
 	Use:   "unregister",
 	Short: "remove current path from list of repos",
-	Run: func(_ *cobra.Command, args []string) {
-		conf := GetConfig()
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conf, err := GetConfig()
+		if err != nil {
+			return err
+		}
 		path, err := os.Getwd()
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			return err
 		}
 		if len(args) == 1 {
 			path = args[0]
-			err = conf.DelRepo(path)
+		} else {
+			r, err := git.PlainOpenWithOptions(path, &(git.PlainOpenOptions{DetectDotGit: true}))
 			if err != nil {
-				log.Println(err)
-				os.Exit(1)
+				return &usageError{err}
 			}
-			return
-		} else if len(args) > 1 {
-			log.Println("too many arguments")
-			os.Exit(1)
-		}
-		r, err := git.PlainOpenWithOptions(path, &(git.PlainOpenOptions{DetectDotGit: true}))
-		if err != nil {
-			log.Println(err)
-			os.Exit(1)
-		}
-		newPath, err := r.Worktree()
-		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			newPath, err := r.Worktree()
+			if err != nil {
+				return err
+			}
+			path = newPath.Filesystem.Root()
 		}
-		path = newPath.Filesystem.Root()
 		err = conf.DelRepo(path)
-		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+		if errors.Is(err, parse.ErrHasDependents) {
+			return &usageError{err}
+		} else if err != nil {
+			return err
 		}
-		err = conf.Save()
-		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+		if dryRun {
+			fmt.Printf("would unregister %s\n", path)
+			return nil
 		}
+		return conf.Save()
 	},
 }
 
@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/taigrr/mg/parse"
+)
+
+// Signature statuses reported by mg verify.
+const (
+	sigGood       = "good"
+	sigUnsigned   = "unsigned"
+	sigBad        = "bad"
+	sigUntrusted  = "untrusted"
+	sigUnknownKey = "unknown key"
+)
+
+// errNotVerified fails repos whose signature is not good.
+var errNotVerified = errors.New("no good signature")
+
+// verification is the signature check of a single commit or tag.
+type verification struct {
+	Object string
+	Status string
+	Signer string
+}
+
+var (
+	verifyTag string
+	verifyRef string
+	verifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "report whether the HEAD commit of every repo is signed",
+		Long: `report whether the HEAD commit of every repo is signed.
+
+OpenPGP signatures are checked against the keyring from the signing config
+(signing.keyring, or signing.key), and SSH signatures against the allowed
+signers file (signing.allowedSigners, or git's gpg.ssh.allowedSignersFile)
+for the committer's email, within the valid-after and valid-before window
+of the key at the commit date. With --tag the annotated tag is checked
+instead. Repos without a good signature count as failed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := checkJobs(); err != nil {
+				return err
+			}
+			if verifyTag != "" && verifyRef != "" {
+				return usageErrorf("--tag and --ref cannot be used together")
+			}
+			conf, err := GetConfig()
+			if err != nil {
+				return err
+			}
+			var (
+				mutex         sync.Mutex
+				verifications = map[string]verification{}
+			)
+			results := forEachRepo(cmd.Context(), conf.Repos, jobs, func(repo parse.Repo) repoResult {
+				r, err := git.PlainOpenWithOptions(repo.Path, &git.PlainOpenOptions{DetectDotGit: true})
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				settings, err := signingSettings(r, conf.Signing, "")
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				v, err := verifyObject(r, settings, verifyTag, verifyRef)
+				if err != nil {
+					return repoResult{Err: err}
+				}
+				mutex.Lock()
+				verifications[repo.Path] = v
+				mutex.Unlock()
+				if v.Status != sigGood {
+					return repoResult{Err: fmt.Errorf("%s: %w", v.Status, errNotVerified)}
+				}
+				return repoResult{}
+			})
+
+			good := 0
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "REPO\tOBJECT\tSIGNATURE\tSIGNER")
+			for _, repo := range conf.Repos {
+				v, ok := verifications[repo.Path]
+				if !ok {
+					continue
+				}
+				if v.Status == sigGood {
+					good++
+				}
+				signer := v.Signer
+				if signer == "" {
+					signer = "-"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", repo.Path, v.Object, v.Status, signer)
+			}
+			tw.Flush()
+			for _, res := range results {
+				// the table already shows why a signature is not good
+				if res.Err != nil && !errors.Is(res.Err, errNotVerified) {
+					log.Printf("error verifying %s: %s\n", res.Repo, res.Err)
+				}
+			}
+			fmt.Println()
+			fmt.Printf("%d/%d repos have a good signature\n", good, len(conf.Repos))
+			return resultsError(results, "verify")
+		},
+	}
+)
+
+// verifyObject checks the signature of the annotated tag named tag, or else
+// of the commit at ref or HEAD.
+func verifyObject(r *git.Repository, settings parse.Signing, tag, ref string) (verification, error) {
+	var (
+		v         verification
+		signature string
+		principal string
+		signed    time.Time
+		payload   = &plumbing.MemoryObject{}
+	)
+	if tag != "" {
+		tagRef, err := r.Tag(tag)
+		if err != nil {
+			return v, err
+		}
+		v.Object = tag
+		t, err := r.TagObject(tagRef.Hash())
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			// lightweight tags cannot be signed
+			v.Status = sigUnsigned
+			return v, nil
+		} else if err != nil {
+			return v, err
+		}
+		if err := t.EncodeWithoutSignature(payload); err != nil {
+			return v, err
+		}
+		signature, principal, signed = t.PGPSignature, t.Tagger.Email, t.Tagger.When
+	} else {
+		hash, err := resolveCommit(r, ref)
+		if err != nil {
+			return v, err
+		}
+		c, err := r.CommitObject(hash)
+		if err != nil {
+			return v, err
+		}
+		v.Object = hash.String()[:7]
+		if err := c.EncodeWithoutSignature(payload); err != nil {
+			return v, err
+		}
+		signature, principal, signed = c.PGPSignature, c.Committer.Email, c.Committer.When
+	}
+	reader, err := payload.Reader()
+	if err != nil {
+		return v, err
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return v, err
+	}
+	v.Status, v.Signer, err = checkSignature(settings, signature, data, principal, signed)
+	return v, err
+}
+
+// resolveCommit resolves ref, or HEAD if ref is empty, to a commit hash.
+func resolveCommit(r *git.Repository, ref string) (plumbing.Hash, error) {
+	if ref == "" {
+		head, err := r.Head()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		return head.Hash(), nil
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("resolving %s: %w", ref, err)
+	}
+	return *hash, nil
+}
+
+// checkSignature checks signature over data and returns its status and the
+// signer. SSH signatures must be made by a key allowed for principal at the
+// time they were signed, which like git is the date of the committer or
+// tagger.
+func checkSignature(settings parse.Signing, signature string, data []byte, principal string, signed time.Time) (string, string, error) {
+	switch {
+	case signature == "":
+		return sigUnsigned, "", nil
+	case strings.HasPrefix(signature, sshsigBegin):
+		pub, err := sshsigVerify([]byte(signature), sshsigNamespace, data)
+		if err != nil {
+			return sigBad, "", nil
+		}
+		fingerprint := ssh.FingerprintSHA256(pub)
+		if settings.AllowedSigners == "" {
+			return sigUntrusted, fingerprint, nil
+		}
+		b, err := os.ReadFile(expandHome(settings.AllowedSigners))
+		if err != nil {
+			return "", "", err
+		}
+		allowed, err := parse.ParseAllowedSigners(b)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", settings.AllowedSigners, err)
+		}
+		for _, a := range allowed {
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(a.Key))
+			if err != nil || !bytes.Equal(key.Marshal(), pub.Marshal()) {
+				continue
+			}
+			if a.Allows(principal, sshsigNamespace) && a.ValidAt(signed) {
+				return sigGood, principal, nil
+			}
+		}
+		return sigUntrusted, fingerprint, nil
+	default:
+		keyring := settings.Keyring
+		if keyring == "" {
+			keyring = settings.Key
+		}
+		if keyring == "" || !fileExists(expandHome(keyring)) {
+			return sigUnknownKey, "", nil
+		}
+		ring, err := readKeyRing(expandHome(keyring))
+		if err != nil {
+			return "", "", fmt.Errorf("reading keyring %s: %w", keyring, err)
+		}
+		entity, err := openpgp.CheckArmoredDetachedSignature(ring, bytes.NewReader(data), strings.NewReader(signature), nil)
+		if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+			return sigUnknownKey, "", nil
+		} else if err != nil {
+			return sigBad, "", nil
+		}
+		if id := entity.PrimaryIdentity(); id != nil {
+			return sigGood, id.Name, nil
+		}
+		return sigGood, fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint), nil
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of jobs to run in parallel")
+	verifyCmd.Flags().StringVar(&verifyTag, "tag", "", "verify this annotated tag instead of HEAD")
+	verifyCmd.Flags().StringVar(&verifyRef, "ref", "", "verify the commit at this branch, tag or hash instead of HEAD")
+}
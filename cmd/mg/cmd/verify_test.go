@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/taigrr/mg/parse"
+)
+
+func TestCheckSignature_SSH(t *testing.T) {
+	_, signer := testSSHKey(t)
+	data := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nsigned commit\n")
+	sig, err := sshSigner{signer}.Sign(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	allowed := filepath.Join(t.TempDir(), "allowed_signers")
+	err = os.WriteFile(allowed, []byte(`alice@example.com valid-after=20240101Z,valid-before=20241231Z `+key+"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := parse.Signing{Format: parse.SigningSSH, AllowedSigners: allowed}
+	during := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		settings  parse.Signing
+		data      []byte
+		principal string
+		signed    time.Time
+		want      string
+	}{
+		{"allowed", settings, data, "alice@example.com", during, sigGood},
+		{"other principal", settings, data, "eve@example.com", during, sigUntrusted},
+		{"before valid-after", settings, data, "alice@example.com", time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), sigUntrusted},
+		{"after valid-before", settings, data, "alice@example.com", time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), sigUntrusted},
+		{"no allowed signers", parse.Signing{Format: parse.SigningSSH}, data, "alice@example.com", during, sigUntrusted},
+		{"changed data", settings, append(data, '!'), "alice@example.com", during, sigBad},
+	}
+	for _, tt := range tests {
+		status, _, err := checkSignature(tt.settings, string(sig), tt.data, tt.principal, tt.signed)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if status != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, status)
+		}
+	}
+}
+
+// writeTestKeyring writes the public keys of entities to an armored keyring.
+func writeTestKeyring(t *testing.T, entities ...*openpgp.Entity) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pubring.asc")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := armor.Encode(f, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entities {
+		if err := e.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckSignature_OpenPGP(t *testing.T) {
+	alice, err := openpgp.NewEntity("Alice", "", "alice@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eve, err := openpgp.NewEntity("Eve", "", "eve@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nsigned commit\n")
+	sig, err := openpgpSigner{alice}.Sign(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := writeTestKeyring(t, alice)
+	settings := parse.Signing{Format: parse.SigningOpenPGP, Keyring: keyring}
+
+	tests := []struct {
+		name     string
+		settings parse.Signing
+		data     []byte
+		want     string
+		signer   string
+	}{
+		{"known key", settings, data, sigGood, "Alice <alice@example.com>"},
+		{"changed data", settings, append(data, '!'), sigBad, ""},
+		{"other keyring", parse.Signing{Keyring: writeTestKeyring(t, eve)}, data, sigUnknownKey, ""},
+		{"no keyring", parse.Signing{}, data, sigUnknownKey, ""},
+	}
+	for _, tt := range tests {
+		status, signer, err := checkSignature(tt.settings, string(sig), tt.data, "alice@example.com", time.Now())
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if status != tt.want || signer != tt.signer {
+			t.Errorf("%s: expected %s by %q, got %s by %q", tt.name, tt.want, tt.signer, status, signer)
+		}
+	}
+
+	if status, _, err := checkSignature(settings, "", data, "alice@example.com", time.Now()); err != nil || status != sigUnsigned {
+		t.Errorf("expected no signature to be unsigned, got %s, %v", status, err)
+	}
+}
@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
+	"io"
 	"os"
+	"syscall"
 
 	"github.com/charmbracelet/fang"
 	"github.com/taigrr/mg/cmd/mg/cmd"
 )
 
 func main() {
-	if err := fang.Execute(context.Background(), cmd.RootCmd); err != nil {
-		os.Exit(1)
-	}
+	err := fang.Execute(context.Background(), cmd.RootCmd,
+		fang.WithNotifySignal(os.Interrupt, syscall.SIGTERM),
+		fang.WithErrorHandler(func(w io.Writer, styles fang.Styles, err error) {
+			if !cmd.Reported(err) {
+				fang.DefaultErrorHandler(w, styles, err)
+			}
+		}))
+	cmd.RecordRun(err)
+	os.Exit(cmd.ExitCode(err))
 }
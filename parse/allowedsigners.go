@@ -0,0 +1,188 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// AllowedSigner is a single entry of an SSH allowed signers file, as used by
+// ssh-keygen -Y verify and git's gpg.ssh.allowedSignersFile.
+type AllowedSigner struct {
+	Principals []string
+	Namespaces []string
+	// ValidAfter and ValidBefore limit when signatures by the key are
+	// valid, they are zero when unlimited.
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	// Key is the public key in authorized_keys format, "type base64".
+	Key string
+}
+
+// ParseAllowedSigners parses an SSH allowed signers file. Each line holds
+// comma separated principal patterns, optional comma separated options and a
+// public key; lines starting with # are comments. The namespaces,
+// valid-after and valid-before options are supported, certificate
+// authorities are not.
+func ParseAllowedSigners(b []byte) ([]AllowedSigner, error) {
+	signers := []AllowedSigner{}
+	for n, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitUnquoted(line, func(r rune) bool { return r == ' ' || r == '\t' })
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected principals and a public key", n+1)
+		}
+		signer := AllowedSigner{Principals: strings.Split(fields[0], ",")}
+		rest := fields[1:]
+		if !isSSHKeyType(rest[0]) {
+			for _, opt := range splitUnquoted(rest[0], func(r rune) bool { return r == ',' }) {
+				name, value, _ := strings.Cut(opt, "=")
+				value = strings.Trim(value, `"`)
+				var err error
+				switch strings.ToLower(name) {
+				case "namespaces":
+					signer.Namespaces = strings.Split(value, ",")
+				case "valid-after":
+					signer.ValidAfter, err = parseSSHTime(value)
+				case "valid-before":
+					signer.ValidBefore, err = parseSSHTime(value)
+				case "cert-authority":
+					err = fmt.Errorf("certificate authorities are not supported")
+				default:
+					err = fmt.Errorf("unsupported option %q", name)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", n+1, err)
+				}
+			}
+			rest = rest[1:]
+		}
+		if len(rest) < 2 || !isSSHKeyType(rest[0]) {
+			return nil, fmt.Errorf("line %d: expected a public key", n+1)
+		}
+		signer.Key = rest[0] + " " + rest[1]
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// Allows reports whether the signer may sign for principal in namespace.
+// Principals and namespaces are matched as pattern lists, like ssh-keygen
+// does.
+func (s AllowedSigner) Allows(principal, namespace string) bool {
+	if len(s.Namespaces) > 0 && !matchPatternList(s.Namespaces, namespace) {
+		return false
+	}
+	return matchPatternList(s.Principals, principal)
+}
+
+// matchPatternList reports whether s matches any of patterns and none of
+// the patterns negated with a leading !, like OpenSSH's match_pattern_list.
+func matchPatternList(patterns []string, s string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matchPattern(negated, s) {
+				return false
+			}
+		} else if matchPattern(pattern, s) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchPattern reports whether s matches pattern, where * matches any
+// sequence of characters and ? any single character. Unlike path.Match,
+// / is not special and there are no character classes or escapes.
+func matchPattern(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := range len(s) + 1 {
+				if matchPattern(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(s)
+			pattern, s = pattern[1:], s[size:]
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return s == ""
+}
+
+// ValidAt reports whether signatures made by the signer at t are valid.
+// Like ssh-keygen, both ends of the validity window are included.
+func (s AllowedSigner) ValidAt(t time.Time) bool {
+	if !s.ValidAfter.IsZero() && t.Before(s.ValidAfter) {
+		return false
+	}
+	return s.ValidBefore.IsZero() || !t.After(s.ValidBefore)
+}
+
+// parseSSHTime parses a time as written in allowed signers files,
+// YYYYMMDD[HHMM[SS]] in local time, or UTC with a Z suffix.
+func parseSSHTime(s string) (time.Time, error) {
+	loc := time.Local
+	if t, ok := strings.CutSuffix(s, "Z"); ok {
+		s, loc = t, time.UTC
+	}
+	layouts := map[int]string{8: "20060102", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(s)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected YYYYMMDD[HHMM[SS]][Z]", s)
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", s, err)
+	}
+	return t, nil
+}
+
+// splitUnquoted splits s at runes for which isSep is true, except inside
+// double quotes. Empty fields are dropped.
+func splitUnquoted(s string, isSep func(rune) bool) []string {
+	fields := []string{}
+	var sb strings.Builder
+	quoted := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			sb.WriteRune(r)
+		case isSep(r) && !quoted:
+			if sb.Len() > 0 {
+				fields = append(fields, sb.String())
+				sb.Reset()
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	if sb.Len() > 0 {
+		fields = append(fields, sb.String())
+	}
+	return fields
+}
+
+func isSSHKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-") || strings.HasPrefix(s, "sk-")
+}
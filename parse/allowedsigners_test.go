@@ -0,0 +1,133 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseAllowedSigners(t *testing.T) {
+	input := `# team keys
+alice@example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAlice alice laptop
+bob@example.com,*@ci.example.com namespaces="git,file" ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQBob
+`
+	signers, err := ParseAllowedSigners([]byte(input))
+	if err != nil {
+		t.Fatalf("ParseAllowedSigners() failed: %v", err)
+	}
+	expected := []AllowedSigner{
+		{
+			Principals: []string{"alice@example.com"},
+			Key:        "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAlice",
+		},
+		{
+			Principals: []string{"bob@example.com", "*@ci.example.com"},
+			Namespaces: []string{"git", "file"},
+			Key:        "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQBob",
+		},
+	}
+	if !reflect.DeepEqual(signers, expected) {
+		t.Errorf("expected %+v, got %+v", expected, signers)
+	}
+}
+
+func TestParseAllowedSigners_Invalid(t *testing.T) {
+	for _, input := range []string{
+		"alice@example.com\n",
+		"alice@example.com ssh-ed25519\n",
+		"alice@example.com cert-authority notakey AAAA\n",
+		"alice@example.com cert-authority ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAlice\n",
+		"alice@example.com no-touch-required ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAlice\n",
+		"alice@example.com valid-after=2024 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAlice\n",
+	} {
+		if _, err := ParseAllowedSigners([]byte(input)); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestAllowedSigner_Allows(t *testing.T) {
+	s := AllowedSigner{Principals: []string{"bob@example.com", "*@ci.example.com"}, Namespaces: []string{"git"}}
+	tests := []struct {
+		principal string
+		namespace string
+		want      bool
+	}{
+		{"bob@example.com", "git", true},
+		{"runner@ci.example.com", "git", true},
+		{"eve@example.com", "git", false},
+		{"bob@example.com", "file", false},
+	}
+	for _, tt := range tests {
+		if got := s.Allows(tt.principal, tt.namespace); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tt.principal, tt.namespace, got, tt.want)
+		}
+	}
+	if !(AllowedSigner{Principals: []string{"alice@example.com"}}).Allows("alice@example.com", "anything") {
+		t.Error("expected a signer without namespaces to allow any namespace")
+	}
+}
+
+func TestMatchPatternList(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		s        string
+		want     bool
+	}{
+		{[]string{"*@example.com"}, "alice@example.com", true},
+		{[]string{"*@example.com"}, "alice@example.org", false},
+		{[]string{"?ob@example.com"}, "bob@example.com", true},
+		{[]string{"?ob@example.com"}, "ob@example.com", false},
+		{[]string{"*@example.com", "!eve@example.com"}, "eve@example.com", false},
+		{[]string{"!eve@example.com", "*@example.com"}, "eve@example.com", false},
+		{[]string{"*@example.com", "!eve@example.com"}, "alice@example.com", true},
+		{[]string{"!eve@example.com"}, "alice@example.com", false},
+		{[]string{"ci/*"}, "ci/runner/1", true},
+		{[]string{"[ab]*"}, "alice", false},
+	}
+	for _, tt := range tests {
+		if got := matchPatternList(tt.patterns, tt.s); got != tt.want {
+			t.Errorf("matchPatternList(%q, %q) = %v, want %v", tt.patterns, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseAllowedSigners_Validity(t *testing.T) {
+	input := `alice@example.com valid-after="20240101",valid-before=20241231235959Z ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAlice`
+	signers, err := ParseAllowedSigners([]byte(input))
+	if err != nil {
+		t.Fatalf("ParseAllowedSigners() failed: %v", err)
+	}
+	s := signers[0]
+	if want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local); !s.ValidAfter.Equal(want) {
+		t.Errorf("expected valid-after %s, got %s", want, s.ValidAfter)
+	}
+	if want := time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC); !s.ValidBefore.Equal(want) {
+		t.Errorf("expected valid-before %s, got %s", want, s.ValidBefore)
+	}
+}
+
+func TestAllowedSigner_ValidAt(t *testing.T) {
+	s := AllowedSigner{
+		ValidAfter:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ValidBefore: time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC), false},
+		{s.ValidAfter, true},
+		{time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), true},
+		{s.ValidBefore, true},
+		{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		if got := s.ValidAt(tt.at); got != tt.want {
+			t.Errorf("ValidAt(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+	if !(AllowedSigner{}).ValidAt(time.Now()) {
+		t.Error("expected a signer without a validity window to always be valid")
+	}
+}
@@ -0,0 +1,68 @@
+package parse
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// GoMod holds the parts of a go.mod file mg needs to relate Go modules
+// across repos: the module path, the go directive and the required modules.
+type GoMod struct {
+	Module   string
+	Go       string
+	Requires []string
+}
+
+// ParseGoMod parses the module, go and require directives of a go.mod file.
+// All other directives are ignored.
+func ParseGoMod(b []byte) (GoMod, error) {
+	mod := GoMod{}
+	block := ""
+	for _, line := range strings.Split(string(b), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+			} else if block == "require" {
+				mod.Requires = append(mod.Requires, unquote(fields[0]))
+			}
+			continue
+		}
+		if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+		switch fields[0] {
+		case "module":
+			if len(fields) > 1 {
+				mod.Module = unquote(fields[1])
+			}
+		case "go":
+			if len(fields) > 1 {
+				mod.Go = fields[1]
+			}
+		case "require":
+			if len(fields) > 1 {
+				mod.Requires = append(mod.Requires, unquote(fields[1]))
+			}
+		}
+	}
+	if mod.Module == "" {
+		return GoMod{}, errors.New("go.mod has no module directive")
+	}
+	return mod, nil
+}
+
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGoMod(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    GoMod
+		wantErr bool
+	}{
+		{
+			name: "single line directives",
+			input: `module github.com/user/lib
+
+go 1.22
+
+require github.com/user/other v1.2.3
+`,
+			want: GoMod{
+				Module:   "github.com/user/lib",
+				Go:       "1.22",
+				Requires: []string{"github.com/user/other"},
+			},
+		},
+		{
+			name: "require blocks and comments",
+			input: `// the service
+module "github.com/user/service" // quoted
+
+go 1.26.1
+
+require (
+	github.com/user/lib v0.1.0
+	github.com/user/other v1.2.3 // indirect
+)
+
+replace github.com/user/lib => ../lib
+
+exclude (
+	github.com/user/broken v1.0.0
+)
+`,
+			want: GoMod{
+				Module:   "github.com/user/service",
+				Go:       "1.26.1",
+				Requires: []string{"github.com/user/lib", "github.com/user/other"},
+			},
+		},
+		{
+			name:    "missing module",
+			input:   "go 1.22\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGoMod([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGoMod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseGoMod() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// JournalKeep is the number of runs kept in the journal, older runs are
+// dropped as new ones are added.
+const JournalKeep = 50
+
+// JournalRun is a single invocation of mg recorded in the journal. Args are
+// the arguments mg was called with and Dir the directory it was called from,
+// so the run can be repeated.
+type JournalRun struct {
+	Command  string        `json:"command"`
+	Args     []string      `json:"args"`
+	Dir      string        `json:"dir"`
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	ExitCode int           `json:"exitCode"`
+	Error    string        `json:"error,omitempty"`
+	Repos    []JournalRepo `json:"repos"`
+}
+
+// JournalRepo is the outcome of a run for a single repo. Step is the part
+// of the command the outcome is for, e.g. "tag" or "push" for mg tag --push.
+type JournalRepo struct {
+	Path     string        `json:"path"`
+	Step     string        `json:"step"`
+	Outcome  string        `json:"outcome"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Outcomes of a repo in a run.
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeSkipped   = "skipped"
+	OutcomeFailed    = "failed"
+)
+
+// Failed returns the paths of the repos that failed in any step of the run,
+// in the order they were run.
+func (r JournalRun) Failed() []string {
+	seen := map[string]bool{}
+	failed := []string{}
+	for _, repo := range r.Repos {
+		if repo.Outcome == OutcomeFailed && !seen[repo.Path] {
+			seen[repo.Path] = true
+			failed = append(failed, repo.Path)
+		}
+	}
+	return failed
+}
+
+// JournalPath returns the path of the journal, $MGJOURNAL if it is set and
+// mg/journal.jsonl in XDG_STATE_HOME, or $HOME/.local/state, otherwise.
+func JournalPath() (string, error) {
+	if path := os.Getenv("MGJOURNAL"); path != "" {
+		return path, nil
+	}
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateDir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateDir, "mg", "journal.jsonl"), nil
+}
+
+// LoadJournal reads the runs in the journal at path, oldest first. A missing
+// journal has no runs.
+func LoadJournal(path string) ([]JournalRun, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ParseJournal(b)
+}
+
+// ParseJournal parses a journal from a byte slice, one run per line.
+func ParseJournal(b []byte) ([]JournalRun, error) {
+	var runs []JournalRun
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var run JournalRun
+		if err := json.Unmarshal(line, &run); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
+
+// AppendJournal adds run to the journal at path, creating it if needed, and
+// drops the oldest runs beyond keep.
+func AppendJournal(path string, run JournalRun, keep int) error {
+	runs, err := LoadJournal(path)
+	if err != nil {
+		return err
+	}
+	runs = append(runs, run)
+	if len(runs) > keep {
+		runs = runs[len(runs)-keep:]
+	}
+	var b bytes.Buffer
+	for _, r := range runs {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// write the new journal next to the old one and swap them, so runs
+	// finishing at the same time never leave a truncated journal
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".journal-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
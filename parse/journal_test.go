@@ -0,0 +1,96 @@
+package parse
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendJournal_KeepsNewestRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mg", "journal.jsonl")
+	for i := range 5 {
+		run := JournalRun{
+			Command: "mg pull",
+			Args:    []string{"pull", "-j", string(rune('1' + i))},
+			Started: time.Date(2026, 1, 1, 0, i, 0, 0, time.UTC),
+		}
+		if err := AppendJournal(path, run, 3); err != nil {
+			t.Fatalf("AppendJournal() unexpected error: %v", err)
+		}
+	}
+
+	runs, err := LoadJournal(path)
+	if err != nil {
+		t.Fatalf("LoadJournal() unexpected error: %v", err)
+	}
+	if len(runs) != 3 {
+		t.Fatalf("LoadJournal() returned %d runs, want 3", len(runs))
+	}
+	for i, run := range runs {
+		if want := time.Date(2026, 1, 1, 0, i+2, 0, 0, time.UTC); !run.Started.Equal(want) {
+			t.Errorf("run %d: expected start %s, got %s", i, want, run.Started)
+		}
+	}
+	if runs[2].Args[2] != "5" {
+		t.Errorf("expected the last run to keep its args, got %v", runs[2].Args)
+	}
+}
+
+func TestLoadJournal_Missing(t *testing.T) {
+	runs, err := LoadJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatalf("LoadJournal() unexpected error: %v", err)
+	}
+	if len(runs) != 0 {
+		t.Errorf("expected no runs, got %d", len(runs))
+	}
+}
+
+func TestParseJournal_Invalid(t *testing.T) {
+	if _, err := ParseJournal([]byte("{\"command\":\"mg pull\"}\nnot json\n")); err == nil {
+		t.Error("ParseJournal() expected an error for an invalid line")
+	}
+}
+
+func TestJournalRun_Failed(t *testing.T) {
+	run := JournalRun{
+		Repos: []JournalRepo{
+			{Path: "/code/a", Step: "tag", Outcome: OutcomeSucceeded},
+			{Path: "/code/b", Step: "tag", Outcome: OutcomeFailed},
+			{Path: "/code/c", Step: "tag", Outcome: OutcomeSkipped},
+			{Path: "/code/a", Step: "push", Outcome: OutcomeFailed},
+			{Path: "/code/b", Step: "push", Outcome: OutcomeFailed},
+		},
+	}
+	failed := run.Failed()
+	want := []string{"/code/b", "/code/a"}
+	if len(failed) != len(want) {
+		t.Fatalf("Failed() = %v, want %v", failed, want)
+	}
+	for i := range want {
+		if failed[i] != want[i] {
+			t.Errorf("Failed()[%d] = %q, want %q", i, failed[i], want[i])
+		}
+	}
+}
+
+func TestJournalPath(t *testing.T) {
+	t.Setenv("MGJOURNAL", "")
+	t.Setenv("XDG_STATE_HOME", "/state")
+	path, err := JournalPath()
+	if err != nil {
+		t.Fatalf("JournalPath() unexpected error: %v", err)
+	}
+	if path != "/state/mg/journal.jsonl" {
+		t.Errorf("JournalPath() = %q, want /state/mg/journal.jsonl", path)
+	}
+
+	t.Setenv("MGJOURNAL", "/tmp/journal.jsonl")
+	path, err = JournalPath()
+	if err != nil {
+		t.Fatalf("JournalPath() unexpected error: %v", err)
+	}
+	if path != "/tmp/journal.jsonl" {
+		t.Errorf("JournalPath() = %q, want /tmp/journal.jsonl", path)
+	}
+}
@@ -2,21 +2,91 @@ package parse
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 )
 
 var errAlreadyRegistered = os.ErrExist
 
+// ErrDependencyCycle is returned when repos depend on each other in a cycle.
+var ErrDependencyCycle = errors.New("dependency cycle")
+
+// ErrHasDependents is returned when removing a repo other repos depend on.
+var ErrHasDependents = errors.New("other repos depend on it")
+
 // MGConfig is the struct that represents the mgconfig file
 // It contains a slice of Repo structs and a map of aliases
 // The aliases map is a map of strings to strings, where the key is the alias
 // and the value is a command to be run
+//
+// URLRewrites maps a base URL to the prefixes it replaces, like git's
+// url.<base>.insteadOf, and is applied to remotes when they are used.
+//
+// Auth configures credentials per remote host, KnownHosts how SSH host keys
+// are verified and Signing how commits and tags are signed.
 type MGConfig struct {
-	Repos   []Repo
-	Aliases map[string]string
+	Repos       []Repo
+	Aliases     map[string]string
+	URLRewrites map[string][]string `json:"urlRewrites,omitempty"`
+	Auth        map[string]HostAuth `json:"auth,omitempty"`
+	KnownHosts  *KnownHosts         `json:"knownHosts,omitempty"`
+	Signing     *Signing            `json:"signing,omitempty"`
+}
+
+// Signing formats.
+const (
+	SigningOpenPGP = "openpgp"
+	SigningSSH     = "ssh"
+)
+
+// Signing configures how commits and tags are signed and verified. Any
+// field left empty falls back to git's own config: gpg.format,
+// user.signingkey and gpg.ssh.allowedSignersFile.
+//
+// Key is the path to an OpenPGP private keyring, or to an SSH private key
+// (or public key, to sign with the matching key in ssh-agent). Keyring is
+// the OpenPGP public keyring used to verify signatures and defaults to Key.
+// AllowedSigners is an SSH allowed signers file used to verify signatures.
+type Signing struct {
+	Format         string `json:"format,omitempty"`
+	Key            string `json:"key,omitempty"`
+	Keyring        string `json:"keyring,omitempty"`
+	AllowedSigners string `json:"allowedSigners,omitempty"`
+}
+
+// Known hosts modes.
+const (
+	// KnownHostsStrict only accepts hosts whose key is already known.
+	KnownHostsStrict = "strict"
+	// KnownHostsAcceptNew records the key of hosts seen for the first time,
+	// but still rejects hosts whose key has changed.
+	KnownHostsAcceptNew = "accept-new"
+)
+
+// KnownHosts configures SSH host key verification. Mode defaults to
+// KnownHostsStrict, and without File the files in $SSH_KNOWN_HOSTS, or
+// ~/.ssh/known_hosts and /etc/ssh/ssh_known_hosts, are used.
+type KnownHosts struct {
+	Mode string `json:"mode,omitempty"`
+	File string `json:"file,omitempty"`
+}
+
+// HostAuth configures how mg authenticates to a single git host.
+//
+// For SSH remotes the private key at SSHKey is used if set, otherwise
+// ssh-agent. For HTTPS remotes the token in the TokenEnv environment
+// variable is used if set, then CredentialHelper, then ~/.netrc. User is
+// the SSH user or HTTPS username and defaults to the one in the URL.
+type HostAuth struct {
+	User             string `json:"user,omitempty"`
+	SSHKey           string `json:"sshKey,omitempty"`
+	TokenEnv         string `json:"tokenEnv,omitempty"`
+	CredentialHelper string `json:"credentialHelper,omitempty"`
 }
 
 // GetRepoPaths returns a slice of strings containing the paths of the repos
@@ -30,7 +100,18 @@ func (m MGConfig) GetRepoPaths() []string {
 	return paths
 }
 
+// DelRepo removes the repo at path. Repos other repos list in DependsOn are
+// kept, as the config would no longer load without them.
 func (m *MGConfig) DelRepo(path string) error {
+	dependents := []string{}
+	for _, v := range m.Repos {
+		if v.Path != path && slices.Contains(v.DependsOn, path) {
+			dependents = append(dependents, v.Path)
+		}
+	}
+	if len(dependents) > 0 {
+		return fmt.Errorf("cannot remove %s, %w: %s", path, ErrHasDependents, strings.Join(dependents, ", "))
+	}
 	for i, v := range m.Repos {
 		if v.Path == path {
 			m.Repos = append(m.Repos[:i], m.Repos[i+1:]...)
@@ -41,13 +122,17 @@ func (m *MGConfig) DelRepo(path string) error {
 }
 
 func (m *MGConfig) AddRepo(path, remote string) error {
+	return m.addRepo(Repo{Path: path, Remote: remote})
+}
+
+func (m *MGConfig) addRepo(repo Repo) error {
 	for _, v := range m.Repos {
-		if v.Path == path {
+		if v.Path == repo.Path {
 			return errAlreadyRegistered
 		}
 	}
 
-	m.Repos = append(m.Repos, Repo{Path: path, Remote: remote})
+	m.Repos = append(m.Repos, repo)
 	return nil
 }
 
@@ -69,7 +154,7 @@ func (s Stats) String() string {
 func (m *MGConfig) Merge(m2 MGConfig) (Stats, error) {
 	stats := Stats{}
 	for _, v := range m2.Repos {
-		err := m.AddRepo(v.Path, v.Remote)
+		err := m.addRepo(v)
 		switch err {
 		case errAlreadyRegistered:
 			stats.Duplicates++
@@ -123,6 +208,9 @@ func ParseMGConfig(b []byte) (MGConfig, error) {
 func (m *MGConfig) ExpandPaths() {
 	for i := range m.Repos {
 		m.Repos[i].Path = os.ExpandEnv(m.Repos[i].Path)
+		for j := range m.Repos[i].DependsOn {
+			m.Repos[i].DependsOn[j] = os.ExpandEnv(m.Repos[i].DependsOn[j])
+		}
 	}
 }
 
@@ -134,12 +222,97 @@ func (m *MGConfig) CollapsePaths() {
 		return
 	}
 	for i := range m.Repos {
-		if strings.HasPrefix(m.Repos[i].Path, home) {
-			m.Repos[i].Path = "$HOME" + m.Repos[i].Path[len(home):]
+		m.Repos[i].Path = collapseHome(m.Repos[i].Path, home)
+		if len(m.Repos[i].DependsOn) == 0 {
+			continue
 		}
+		// copy so collapsing never touches the caller's slice
+		deps := make([]string, len(m.Repos[i].DependsOn))
+		for j, dep := range m.Repos[i].DependsOn {
+			deps[j] = collapseHome(dep, home)
+		}
+		m.Repos[i].DependsOn = deps
 	}
 }
 
+// collapseHome replaces a leading home directory in path with $HOME.
+func collapseHome(path, home string) string {
+	if strings.HasPrefix(path, home) {
+		return "$HOME" + path[len(home):]
+	}
+	return path
+}
+
+// Dependencies returns the DependsOn paths of every repo keyed by repo path.
+// It returns an error if a repo depends on a path that is not registered,
+// or if the dependencies contain a cycle.
+func (m MGConfig) Dependencies() (map[string][]string, error) {
+	registered := map[string]bool{}
+	for _, r := range m.Repos {
+		registered[r.Path] = true
+	}
+	deps := map[string][]string{}
+	for _, r := range m.Repos {
+		for _, dep := range r.DependsOn {
+			if !registered[dep] {
+				return nil, fmt.Errorf("repo %s depends on unregistered repo %s", r.Path, dep)
+			}
+		}
+		if len(r.DependsOn) > 0 {
+			deps[r.Path] = r.DependsOn
+		}
+	}
+	return deps, CheckDependencies(deps)
+}
+
+// CheckDependencies returns an error wrapping ErrDependencyCycle if deps,
+// a map from repo path to the paths it depends on, contains a cycle.
+func CheckDependencies(deps map[string][]string) error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	stack := []string{}
+	var visit func(path string) error
+	visit = func(path string) error {
+		switch state[path] {
+		case done:
+			return nil
+		case visiting:
+			// report the cycle starting from the first time we saw path
+			for i, p := range stack {
+				if p == path {
+					cycle := append(append([]string{}, stack[i:]...), path)
+					return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(cycle, " -> "))
+				}
+			}
+		}
+		state[path] = visiting
+		stack = append(stack, path)
+		for _, dep := range deps[path] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[path] = done
+		return nil
+	}
+	paths := make([]string, 0, len(deps))
+	for path := range deps {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := visit(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m MGConfig) Save() error {
 	mgConf := os.Getenv("MGCONFIG")
 	if mgConf == "" {
@@ -158,8 +331,12 @@ func (m MGConfig) Save() error {
 	}
 	// Collapse paths before saving so config is portable
 	toSave := MGConfig{
-		Repos:   make([]Repo, len(m.Repos)),
-		Aliases: m.Aliases,
+		Repos:       make([]Repo, len(m.Repos)),
+		Aliases:     m.Aliases,
+		URLRewrites: m.URLRewrites,
+		Auth:        m.Auth,
+		KnownHosts:  m.KnownHosts,
+		Signing:     m.Signing,
 	}
 	copy(toSave.Repos, m.Repos)
 	toSave.CollapsePaths()
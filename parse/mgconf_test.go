@@ -2,8 +2,10 @@ package parse
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -438,6 +440,28 @@ func TestDelRepo(t *testing.T) {
 	}
 }
 
+func TestDelRepo_Dependents(t *testing.T) {
+	conf := MGConfig{Repos: []Repo{
+		{Path: "/code/a", DependsOn: []string{"/code/b"}},
+		{Path: "/code/b"},
+	}}
+	if err := conf.DelRepo("/code/b"); !errors.Is(err, ErrHasDependents) {
+		t.Fatalf("DelRepo() expected ErrHasDependents, got %v", err)
+	}
+	if len(conf.Repos) != 2 {
+		t.Errorf("expected no repo to be removed, got %v", conf.Repos)
+	}
+	if _, err := conf.Dependencies(); err != nil {
+		t.Errorf("expected the config to stay valid, got %v", err)
+	}
+	if err := conf.DelRepo("/code/a"); err != nil {
+		t.Errorf("DelRepo() unexpected error removing the dependent: %v", err)
+	}
+	if err := conf.DelRepo("/code/b"); err != nil {
+		t.Errorf("DelRepo() unexpected error once nothing depends on it: %v", err)
+	}
+}
+
 func TestMerge(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -528,3 +552,206 @@ func TestGetRepoPaths(t *testing.T) {
 		}
 	}
 }
+
+func TestParseMGConfig_RepoOptions(t *testing.T) {
+	input := `{
+		"Repos": [
+			{
+				"Path": "$HOME/code/project",
+				"Remote": "git@github.com:user/project.git",
+				"branch": "develop",
+				"clone": {"depth": 1, "singleBranch": true, "recurseSubmodules": true}
+			},
+			{"Path": "$HOME/code/plain", "Remote": "git@github.com:user/plain.git"}
+		]
+	}`
+
+	conf, err := ParseMGConfig([]byte(input))
+	if err != nil {
+		t.Fatalf("ParseMGConfig() unexpected error: %v", err)
+	}
+	if len(conf.Repos) != 2 {
+		t.Fatalf("ParseMGConfig() got %d repos, want 2", len(conf.Repos))
+	}
+
+	repo := conf.Repos[0]
+	if repo.Branch != "develop" {
+		t.Errorf("Branch = %q, want %q", repo.Branch, "develop")
+	}
+	if repo.Clone == nil {
+		t.Fatal("Clone options not parsed")
+	}
+	if repo.Clone.Depth != 1 || !repo.Clone.SingleBranch || !repo.Clone.RecurseSubmodules {
+		t.Errorf("Clone = %+v, want depth 1, single branch, recurse submodules", *repo.Clone)
+	}
+	if repo.Clone.Bare || repo.Clone.Mirror {
+		t.Errorf("Clone = %+v, want bare and mirror unset", *repo.Clone)
+	}
+	if conf.Repos[1].Clone != nil {
+		t.Errorf("expected no clone options for plain repo, got %+v", *conf.Repos[1].Clone)
+	}
+
+	// Repos without options should not gain empty keys when saved
+	b, err := json.Marshal(conf.Repos[1])
+	if err != nil {
+		t.Fatalf("failed to marshal repo: %v", err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(b, &raw); err != nil {
+		t.Fatalf("failed to unmarshal repo: %v", err)
+	}
+	for _, key := range []string{"branch", "clone"} {
+		if _, ok := raw[key]; ok {
+			t.Errorf("expected %q to be omitted, got %s", key, b)
+		}
+	}
+}
+
+func TestMerge_KeepsRepoOptions(t *testing.T) {
+	conf := MGConfig{}
+	other := MGConfig{
+		Repos: []Repo{
+			{
+				Path:   "$HOME/code/project",
+				Remote: "git@github.com:user/project.git",
+				Branch: "develop",
+				Clone:  &CloneOptions{Depth: 1},
+			},
+		},
+	}
+
+	if _, err := conf.Merge(other); err != nil {
+		t.Fatalf("Merge() unexpected error: %v", err)
+	}
+	if len(conf.Repos) != 1 {
+		t.Fatalf("Merge() repo count = %d, want 1", len(conf.Repos))
+	}
+	if conf.Repos[0].Branch != "develop" {
+		t.Errorf("Branch = %q, want %q", conf.Repos[0].Branch, "develop")
+	}
+	if conf.Repos[0].Clone == nil || conf.Repos[0].Clone.Depth != 1 {
+		t.Errorf("Clone options were not merged")
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		repos     []Repo
+		wantDeps  map[string][]string
+		wantErr   bool
+		wantCycle bool
+	}{
+		{
+			name: "no dependencies",
+			repos: []Repo{
+				{Path: "/code/lib"},
+				{Path: "/code/service"},
+			},
+			wantDeps: map[string][]string{},
+		},
+		{
+			name: "chain",
+			repos: []Repo{
+				{Path: "/code/lib"},
+				{Path: "/code/client", DependsOn: []string{"/code/lib"}},
+				{Path: "/code/service", DependsOn: []string{"/code/lib", "/code/client"}},
+			},
+			wantDeps: map[string][]string{
+				"/code/client":  {"/code/lib"},
+				"/code/service": {"/code/lib", "/code/client"},
+			},
+		},
+		{
+			name: "unregistered dependency",
+			repos: []Repo{
+				{Path: "/code/service", DependsOn: []string{"/code/missing"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "cycle",
+			repos: []Repo{
+				{Path: "/code/a", DependsOn: []string{"/code/b"}},
+				{Path: "/code/b", DependsOn: []string{"/code/c"}},
+				{Path: "/code/c", DependsOn: []string{"/code/a"}},
+			},
+			wantErr:   true,
+			wantCycle: true,
+		},
+		{
+			name: "self dependency",
+			repos: []Repo{
+				{Path: "/code/a", DependsOn: []string{"/code/a"}},
+			},
+			wantErr:   true,
+			wantCycle: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := MGConfig{Repos: tt.repos}
+			deps, err := conf.Dependencies()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Dependencies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrDependencyCycle) != tt.wantCycle {
+				t.Errorf("Dependencies() error = %v, want cycle %v", err, tt.wantCycle)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(deps, tt.wantDeps) {
+				t.Errorf("Dependencies() = %v, want %v", deps, tt.wantDeps)
+			}
+		})
+	}
+}
+
+func TestExpandAndCollapse_DependsOn(t *testing.T) {
+	t.Setenv("HOME", "/home/testuser")
+	original := []string{"$HOME/code/lib"}
+	conf := MGConfig{
+		Repos: []Repo{
+			{Path: "$HOME/code/service", DependsOn: original},
+		},
+	}
+
+	conf.ExpandPaths()
+	if got := conf.Repos[0].DependsOn[0]; got != "/home/testuser/code/lib" {
+		t.Errorf("after expand: expected %q, got %q", "/home/testuser/code/lib", got)
+	}
+
+	expanded := conf.Repos[0].DependsOn
+	conf.CollapsePaths()
+	if got := conf.Repos[0].DependsOn[0]; got != "$HOME/code/lib" {
+		t.Errorf("after collapse: expected %q, got %q", "$HOME/code/lib", got)
+	}
+	if expanded[0] != "/home/testuser/code/lib" {
+		t.Errorf("CollapsePaths() modified a shared slice: %q", expanded[0])
+	}
+}
+
+func TestSave_KeepsURLRewrites(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "mgconfig")
+	t.Setenv("MGCONFIG", configPath)
+
+	conf := MGConfig{
+		Repos: []Repo{{Path: "/opt/repo", Remote: "gh:user/repo"}},
+		URLRewrites: map[string][]string{
+			"git@github.com:": {"https://github.com/"},
+		},
+	}
+	if err := conf.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	loaded, err := LoadMGConfig()
+	if err != nil {
+		t.Fatalf("LoadMGConfig() failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.URLRewrites, conf.URLRewrites) {
+		t.Errorf("expected urlRewrites %v, got %v", conf.URLRewrites, loaded.URLRewrites)
+	}
+	// the stored remote is saved as written, not resolved
+	if loaded.Repos[0].Remote != "gh:user/repo" {
+		t.Errorf("expected remote to be saved unresolved, got %q", loaded.Repos[0].Remote)
+	}
+}
@@ -12,10 +12,32 @@ type MRConfig struct {
 	Repos   []Repo
 	Aliases map[string]string
 }
+
+// Repo is a single registered repo.
+//
+// DependsOn lists the paths of repos that commands changing repos, such as
+// pull and push, must process before this one, e.g. libraries that have to
+// be pushed before the services consuming them.
+//
+// Tags are free-form labels, e.g. for use in commit message templates.
 type Repo struct {
-	Path    string
-	Remote  string
-	Aliases map[string]string `json:"aliases,omitempty"`
+	Path      string
+	Remote    string
+	Branch    string            `json:"branch,omitempty"`
+	Clone     *CloneOptions     `json:"clone,omitempty"`
+	DependsOn []string          `json:"dependsOn,omitempty"`
+	Aliases   map[string]string `json:"aliases,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+}
+
+// CloneOptions holds the per-repo settings used when mg clones a repo.
+// Any of these can be overridden for a single run with flags on mg clone.
+type CloneOptions struct {
+	Depth             int  `json:"depth,omitempty"`
+	SingleBranch      bool `json:"singleBranch,omitempty"`
+	RecurseSubmodules bool `json:"recurseSubmodules,omitempty"`
+	Bare              bool `json:"bare,omitempty"`
+	Mirror            bool `json:"mirror,omitempty"`
 }
 
 // GetRepoPaths returns a slice of strings containing the paths of all repos
@@ -29,7 +51,7 @@ func (m MRConfig) GetRepoPaths() []string {
 }
 
 func (m MRConfig) ToMGConfig() MGConfig {
-	mgconf := MGConfig(m)
+	mgconf := MGConfig{Repos: m.Repos, Aliases: m.Aliases}
 	for i, repo := range mgconf.Repos {
 		checkout := repo.Remote
 		if after, ok := strings.CutPrefix(checkout, "git clone '"); ok {
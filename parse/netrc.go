@@ -0,0 +1,123 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NetrcMachine is a single machine (or default) entry of a netrc file.
+type NetrcMachine struct {
+	Name     string
+	Login    string
+	Password string
+}
+
+// Netrc holds the entries of a netrc file in the order they appear.
+type Netrc struct {
+	Machines []NetrcMachine
+	Default  *NetrcMachine
+}
+
+// LoadNetrc loads the netrc file named by $NETRC, or ~/.netrc.
+// If the file does not exist, an error is returned.
+func LoadNetrc() (Netrc, error) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Netrc{}, err
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Netrc{}, err
+	}
+	return ParseNetrc(b), nil
+}
+
+// ParseNetrc parses the contents of a netrc file. Entries may span lines or
+// share a line, lines starting with # are comments and macdef bodies are
+// skipped. Unknown tokens are ignored.
+func ParseNetrc(b []byte) Netrc {
+	var (
+		n       Netrc
+		current *NetrcMachine
+		tokens  []string
+	)
+	lines := strings.Split(string(b), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for j, f := range fields {
+			if f == "macdef" {
+				// a macro runs until the next empty line
+				tokens = append(tokens, fields[:j]...)
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				fields = nil
+				break
+			}
+		}
+		tokens = append(tokens, fields...)
+	}
+
+	finish := func() {
+		if current == nil {
+			return
+		}
+		if current.Name == "" {
+			n.Default = current
+		} else {
+			n.Machines = append(n.Machines, *current)
+		}
+		current = nil
+	}
+	for i := 0; i < len(tokens); i++ {
+		value := ""
+		if i+1 < len(tokens) {
+			value = tokens[i+1]
+		}
+		switch tokens[i] {
+		case "machine":
+			finish()
+			current = &NetrcMachine{Name: value}
+			i++
+		case "default":
+			finish()
+			current = &NetrcMachine{}
+		case "login":
+			if current != nil {
+				current.Login = value
+			}
+			i++
+		case "password":
+			if current != nil {
+				current.Password = value
+			}
+			i++
+		case "account":
+			i++
+		}
+	}
+	finish()
+	return n
+}
+
+// Find returns the entry for host, falling back to the default entry.
+func (n Netrc) Find(host string) (NetrcMachine, bool) {
+	for _, m := range n.Machines {
+		if m.Name == host {
+			return m, true
+		}
+	}
+	if n.Default != nil {
+		return *n.Default, true
+	}
+	return NetrcMachine{}, false
+}
@@ -0,0 +1,67 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	input := `# personal hosts
+machine github.com
+  login octocat
+  password ghp_secret
+
+machine git.example.com login ci password "tok" account ops
+macdef init
+  cd /pub
+  passive
+
+machine gitlab.com login me password glpat
+default login anonymous password guest
+`
+	n := ParseNetrc([]byte(input))
+
+	expected := []NetrcMachine{
+		{Name: "github.com", Login: "octocat", Password: "ghp_secret"},
+		{Name: "git.example.com", Login: "ci", Password: `"tok"`},
+		{Name: "gitlab.com", Login: "me", Password: "glpat"},
+	}
+	if !reflect.DeepEqual(n.Machines, expected) {
+		t.Errorf("expected machines %+v, got %+v", expected, n.Machines)
+	}
+	if n.Default == nil || n.Default.Login != "anonymous" || n.Default.Password != "guest" {
+		t.Errorf("unexpected default entry: %+v", n.Default)
+	}
+}
+
+func TestNetrc_Find(t *testing.T) {
+	n := ParseNetrc([]byte("machine github.com login a password b\n"))
+	if m, ok := n.Find("github.com"); !ok || m.Login != "a" || m.Password != "b" {
+		t.Errorf("unexpected entry for github.com: %+v, %v", m, ok)
+	}
+	if _, ok := n.Find("gitlab.com"); ok {
+		t.Error("expected no entry for gitlab.com")
+	}
+
+	n = ParseNetrc([]byte("machine github.com login a password b\ndefault login c password d\n"))
+	if m, ok := n.Find("gitlab.com"); !ok || m.Login != "c" {
+		t.Errorf("expected default entry, got %+v, %v", m, ok)
+	}
+}
+
+func TestLoadNetrc(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(path, []byte("machine example.com login x password y\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", path)
+	n, err := LoadNetrc()
+	if err != nil {
+		t.Fatalf("LoadNetrc() failed: %v", err)
+	}
+	if m, ok := n.Find("example.com"); !ok || m.Password != "y" {
+		t.Errorf("unexpected entry: %+v, %v", m, ok)
+	}
+}
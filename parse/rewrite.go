@@ -0,0 +1,50 @@
+package parse
+
+import "strings"
+
+// shorthands are the built-in remote prefixes expanded by ResolveRemote.
+var shorthands = map[string]string{
+	"gh:": "https://github.com/",
+	"gl:": "https://gitlab.com/",
+	"bb:": "https://bitbucket.org/",
+}
+
+// ResolveRemote returns the URL to use for remote. Shorthands such as
+// gh:org/repo are expanded to HTTPS URLs first, then the URLRewrites rule
+// with the longest matching prefix is applied, like git's insteadOf. Rules
+// may also rewrite the shorthands themselves, e.g. "git@github.com:"
+// instead of "gh:". The stored remote is left as is so the config stays
+// portable between machines.
+func (m MGConfig) ResolveRemote(remote string) string {
+	if base, prefix := longestRewrite(m.URLRewrites, remote); prefix != "" {
+		return base + remote[len(prefix):]
+	}
+	for prefix, base := range shorthands {
+		if after, ok := strings.CutPrefix(remote, prefix); ok {
+			remote = base + after
+			break
+		}
+	}
+	if base, prefix := longestRewrite(m.URLRewrites, remote); prefix != "" {
+		return base + remote[len(prefix):]
+	}
+	return remote
+}
+
+// longestRewrite returns the base and matched prefix of the rule in rewrites
+// whose prefix is the longest match for url. Ties are broken by base so the
+// result does not depend on map order.
+func longestRewrite(rewrites map[string][]string, url string) (string, string) {
+	base, match := "", ""
+	for b, prefixes := range rewrites {
+		for _, prefix := range prefixes {
+			if prefix == "" || !strings.HasPrefix(url, prefix) {
+				continue
+			}
+			if len(prefix) > len(match) || (len(prefix) == len(match) && b < base) {
+				base, match = b, prefix
+			}
+		}
+	}
+	return base, match
+}
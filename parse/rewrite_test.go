@@ -0,0 +1,74 @@
+package parse
+
+import "testing"
+
+func TestResolveRemote(t *testing.T) {
+	conf := MGConfig{
+		URLRewrites: map[string][]string{
+			"git@github.com:":         {"https://github.com/"},
+			"git@git.example.com:":    {"https://git.example.com/", "ex:"},
+			"git@git.example.com:ci/": {"https://git.example.com/ci/"},
+			"git@mirror.local:":       {"gl:"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		want   string
+	}{
+		{
+			name:   "no matching rule",
+			remote: "git@bitbucket.org:user/repo.git",
+			want:   "git@bitbucket.org:user/repo.git",
+		},
+		{
+			name:   "insteadOf rewrite",
+			remote: "https://github.com/user/repo.git",
+			want:   "git@github.com:user/repo.git",
+		},
+		{
+			name:   "longest prefix wins",
+			remote: "https://git.example.com/ci/tools.git",
+			want:   "git@git.example.com:ci/tools.git",
+		},
+		{
+			name:   "custom shorthand",
+			remote: "ex:team/app.git",
+			want:   "git@git.example.com:team/app.git",
+		},
+		{
+			name:   "builtin shorthand is rewritten after expansion",
+			remote: "gh:user/repo",
+			want:   "git@github.com:user/repo",
+		},
+		{
+			name:   "rule for the shorthand itself takes precedence",
+			remote: "gl:group/repo.git",
+			want:   "git@mirror.local:group/repo.git",
+		},
+		{
+			name:   "builtin shorthand without rules",
+			remote: "bb:user/repo.git",
+			want:   "https://bitbucket.org/user/repo.git",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := conf.ResolveRemote(tt.remote); got != tt.want {
+				t.Errorf("ResolveRemote(%q) = %q, want %q", tt.remote, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveRemote_NoRewrites(t *testing.T) {
+	conf := MGConfig{}
+	if got := conf.ResolveRemote("gh:user/repo.git"); got != "https://github.com/user/repo.git" {
+		t.Errorf("unexpected expansion: %q", got)
+	}
+	if got := conf.ResolveRemote("/srv/git/repo.git"); got != "/srv/git/repo.git" {
+		t.Errorf("local path changed: %q", got)
+	}
+}
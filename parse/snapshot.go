@@ -0,0 +1,100 @@
+package parse
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+)
+
+// Snapshot records the exact commit every repo was at, so that a multi-repo
+// workspace can be restored to that state later on.
+type Snapshot struct {
+	Repos []SnapshotRepo `json:"repos"`
+}
+
+// SnapshotRepo is the recorded state of a single repo. Branch is empty when
+// the repo had a detached HEAD.
+type SnapshotRepo struct {
+	Path   string `json:"path"`
+	Remote string `json:"remote"`
+	Branch string `json:"branch,omitempty"`
+	Head   string `json:"head"`
+}
+
+// SnapshotChange describes how a repo differs between two snapshots.
+// Old is nil for repos only present in the newer snapshot, and New is nil
+// for repos only present in the older one.
+type SnapshotChange struct {
+	Path string
+	Old  *SnapshotRepo
+	New  *SnapshotRepo
+}
+
+// LoadSnapshot reads a snapshot file and expands shell variables in its
+// repo paths.
+func LoadSnapshot(path string) (Snapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return ParseSnapshot(b)
+}
+
+// ParseSnapshot parses a snapshot from a byte slice and expands shell
+// variables in its repo paths.
+func ParseSnapshot(b []byte) (Snapshot, error) {
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return Snapshot{}, err
+	}
+	for i := range s.Repos {
+		s.Repos[i].Path = os.ExpandEnv(s.Repos[i].Path)
+	}
+	return s, nil
+}
+
+// Save writes the snapshot to path, replacing the user's home directory
+// with $HOME so the file can be shared across machines.
+func (s Snapshot) Save(path string) error {
+	toSave := Snapshot{Repos: make([]SnapshotRepo, len(s.Repos))}
+	copy(toSave.Repos, s.Repos)
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		for i := range toSave.Repos {
+			toSave.Repos[i].Path = collapseHome(toSave.Repos[i].Path, home)
+		}
+	}
+	b, err := json.MarshalIndent(toSave, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// DiffSnapshots returns the repos whose HEAD or branch differ between a and
+// b, as well as repos only present in one of them, sorted by path.
+func DiffSnapshots(a, b Snapshot) []SnapshotChange {
+	old := map[string]*SnapshotRepo{}
+	for i := range a.Repos {
+		old[a.Repos[i].Path] = &a.Repos[i]
+	}
+	changes := []SnapshotChange{}
+	for i := range b.Repos {
+		repo := &b.Repos[i]
+		prev, ok := old[repo.Path]
+		delete(old, repo.Path)
+		if ok && prev.Head == repo.Head && prev.Branch == repo.Branch {
+			continue
+		}
+		if !ok {
+			prev = nil
+		}
+		changes = append(changes, SnapshotChange{Path: repo.Path, Old: prev, New: repo})
+	}
+	for path, repo := range old {
+		changes = append(changes, SnapshotChange{Path: path, Old: repo})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
@@ -0,0 +1,87 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	a := Snapshot{
+		Repos: []SnapshotRepo{
+			{Path: "/code/same", Branch: "main", Head: "aaa"},
+			{Path: "/code/moved", Branch: "main", Head: "bbb"},
+			{Path: "/code/switched", Branch: "main", Head: "ccc"},
+			{Path: "/code/removed", Branch: "main", Head: "ddd"},
+		},
+	}
+	b := Snapshot{
+		Repos: []SnapshotRepo{
+			{Path: "/code/same", Branch: "main", Head: "aaa"},
+			{Path: "/code/moved", Branch: "main", Head: "eee"},
+			{Path: "/code/switched", Branch: "dev", Head: "ccc"},
+			{Path: "/code/added", Branch: "main", Head: "fff"},
+		},
+	}
+
+	changes := DiffSnapshots(a, b)
+	want := []string{"/code/added", "/code/moved", "/code/removed", "/code/switched"}
+	if len(changes) != len(want) {
+		t.Fatalf("DiffSnapshots() returned %d changes, want %d", len(changes), len(want))
+	}
+	for i, change := range changes {
+		if change.Path != want[i] {
+			t.Errorf("change %d: expected path %q, got %q", i, want[i], change.Path)
+		}
+	}
+	if changes[0].Old != nil || changes[0].New == nil {
+		t.Errorf("added repo should only have a new state, got %+v", changes[0])
+	}
+	if changes[1].Old.Head != "bbb" || changes[1].New.Head != "eee" {
+		t.Errorf("moved repo: expected bbb -> eee, got %s -> %s", changes[1].Old.Head, changes[1].New.Head)
+	}
+	if changes[2].Old == nil || changes[2].New != nil {
+		t.Errorf("removed repo should only have an old state, got %+v", changes[2])
+	}
+}
+
+func TestSnapshot_SaveAndLoad(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatalf("failed to get home directory: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	snap := Snapshot{
+		Repos: []SnapshotRepo{
+			{
+				Path:   filepath.Join(home, "code/project"),
+				Remote: "git@github.com:user/project.git",
+				Branch: "main",
+				Head:   "0123456789abcdef0123456789abcdef01234567",
+			},
+		},
+	}
+
+	if err := snap.Save(path); err != nil {
+		t.Fatalf("Save() unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+	if !strings.Contains(string(b), "$HOME/code/project") {
+		t.Errorf("expected saved snapshot to use $HOME, got %s", b)
+	}
+	if snap.Repos[0].Path != filepath.Join(home, "code/project") {
+		t.Errorf("Save() modified the original snapshot: %q", snap.Repos[0].Path)
+	}
+
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() unexpected error: %v", err)
+	}
+	if len(loaded.Repos) != 1 || loaded.Repos[0] != snap.Repos[0] {
+		t.Errorf("LoadSnapshot() = %+v, want %+v", loaded.Repos, snap.Repos)
+	}
+}